@@ -11,22 +11,22 @@ if not exist "releases" (
 echo 编译 Windows x64...
 set GOOS=windows
 set GOARCH=amd64
-go build -o releases\cyberscan_windows_x64.exe ./cmd/main.go
+go build -o releases\cyberscan_windows_x64.exe ./cmd
 
 echo 编译 Linux x64...
 set GOOS=linux
 set GOARCH=amd64
-go build -o releases\cyberscan_linux_x64 ./cmd/main.go
+go build -o releases\cyberscan_linux_x64 ./cmd
 
 echo 编译 macOS ARM64...
 set GOOS=darwin
 set GOARCH=arm64
-go build -o releases\cyberscan_darwin_arm64 ./cmd/main.go
+go build -o releases\cyberscan_darwin_arm64 ./cmd
 
 echo 编译 macOS x64...
 set GOOS=darwin
 set GOARCH=amd64
-go build -o releases\cyberscan_darwin_x64 ./cmd/main.go
+go build -o releases\cyberscan_darwin_x64 ./cmd
 
 echo 编译完成！
 dir releases\cyberscan_*
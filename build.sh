@@ -16,19 +16,19 @@ fi
 
 # Windows x64
 echo "编译 Windows x64..."
-GOOS=windows GOARCH=amd64 go build -o "$RELEASES_DIR/cyberscan_windows_x64.exe" ./cmd/main.go
+GOOS=windows GOARCH=amd64 go build -o "$RELEASES_DIR/cyberscan_windows_x64.exe" ./cmd
 
 # Linux x64
 echo "编译 Linux x64..."
-GOOS=linux GOARCH=amd64 go build -o "$RELEASES_DIR/cyberscan_linux_x64" ./cmd/main.go
+GOOS=linux GOARCH=amd64 go build -o "$RELEASES_DIR/cyberscan_linux_x64" ./cmd
 
 # macOS ARM64 (Apple Silicon)
 echo "编译 macOS ARM64..."
-GOOS=darwin GOARCH=arm64 go build -o "$RELEASES_DIR/cyberscan_darwin_arm64" ./cmd/main.go
+GOOS=darwin GOARCH=arm64 go build -o "$RELEASES_DIR/cyberscan_darwin_arm64" ./cmd
 
 # macOS x64 (Intel)
 echo "编译 macOS x64..."
-GOOS=darwin GOARCH=amd64 go build -o "$RELEASES_DIR/cyberscan_darwin_x64" ./cmd/main.go
+GOOS=darwin GOARCH=amd64 go build -o "$RELEASES_DIR/cyberscan_darwin_x64" ./cmd
 
 echo "编译完成！生成的文件："
 ls -la "$RELEASES_DIR"/cyberscan_*
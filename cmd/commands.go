@@ -0,0 +1,108 @@
+package main
+
+import (
+	"cyberspace_mapping_summary/internal/config"
+	"cyberspace_mapping_summary/internal/database"
+	"cyberspace_mapping_summary/internal/util"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// printUsage 输出子命令用法
+func printUsage() {
+	fmt.Println("用法:")
+	fmt.Println("  cyberscan                      执行完整测绘流程（读取config.yaml与目标文件）")
+	fmt.Println("  cyberscan diff <任务A> <任务B>   对比两个任务：新增、消失、变化的资产")
+	fmt.Println("  cyberscan list                 列出全部任务及其资产数量、日期")
+	fmt.Println("  cyberscan show <任务>           显示任务概况：元数据、去重规则、资产与错误")
+	fmt.Println("  cyberscan delete [-y] [-before YYYYMMDD] [任务...]")
+	fmt.Println("                                 删除任务（跨任务清单保留）")
+	fmt.Println("  cyberscan merge [-name 项目名称] <任务A> <任务B> [任务...]")
+	fmt.Println("                                 将多个任务按去重规则合并为一个新任务")
+	fmt.Println("  cyberscan mergedb <res.db...>   合并其他分析人员的res.db：任务按原任务ID导入，跨任务清单按资产合并")
+	fmt.Println("  cyberscan rename <任务> <项目名称>")
+	fmt.Println("                                 设置任务的项目名称")
+	fmt.Println("  cyberscan search [-task 任务] [-unit 单位] [-source 平台] [-port 端口] [-reliability N] [-o 文件.csv] <关键词...>")
+	fmt.Println("                                 按标题、域名、主机、Server、Banner 搜索资产（默认跨任务清单）")
+	fmt.Println("  cyberscan import -format 格式 -unit 单位 [-task 任务 | -name 项目名称] <文件...>")
+	fmt.Println("                                 导入 subfinder / amass / httpx / nmap / masscan 结果与 FOFA / Hunter 网页端导出的CSV")
+	fmt.Println("")
+	fmt.Println("任务可写为任务ID（20250726_12345678_a1b2c3）、任务表名（task_20250726_12345678_a1b2c3）或项目名称（同名取最新任务）")
+}
+
+// runCommand 分发子命令，返回进程退出码
+func runCommand(name string, args []string) int {
+	switch name {
+	case "diff":
+		return runDiff(args)
+	case "list":
+		return runList(args)
+	case "show":
+		return runShow(args)
+	case "delete":
+		return runDelete(args)
+	case "merge":
+		return runMerge(args)
+	case "mergedb":
+		return runMergeDB(args)
+	case "rename":
+		return runRename(args)
+	case "search":
+		return runSearch(args)
+	case "import":
+		return runImport(args)
+	case "help", "-h", "--help":
+		printUsage()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", name)
+		printUsage()
+		return 1
+	}
+}
+
+// openStorage 按配置打开结果存储：默认为本地 res.db（可由 database.path 指定），配置 database.driver: postgres 时连接共享数据库
+func openStorage(cfg *config.Config) (database.Storage, error) {
+	dsn := defaultDBPath
+	if cfg.Database.Path != "" {
+		dsn = cfg.Database.Path
+	}
+	if cfg.Database.Driver == database.DriverPostgres || cfg.Database.Driver == "postgresql" {
+		dsn = cfg.Database.DSN
+	}
+	return database.Open(cfg.Database.Driver, dsn)
+}
+
+// openCommandStorage 子命令打开结果存储，配置读取自 config.yaml（不存在时使用默认的 res.db）
+func openCommandStorage() (database.Storage, error) {
+	cfg, err := config.ReadConfig("config.yaml")
+	if err != nil {
+		return nil, err
+	}
+	return openStorage(cfg)
+}
+
+// claimTask 生成任务ID并占用任务锁；ID 已存在或正被占用时重新生成
+func claimTask(store database.Storage) (string, string, error) {
+	for i := 0; i < 5; i++ {
+		taskID := util.GenerateTaskID()
+		tableName := util.GenerateTableName(taskID)
+
+		exists, err := store.TaskExists(tableName)
+		if err != nil {
+			return "", "", err
+		}
+		if exists {
+			continue
+		}
+		if err := store.LockTask(tableName); err != nil {
+			if errors.Is(err, database.ErrTaskLocked) {
+				continue
+			}
+			return "", "", err
+		}
+		return taskID, tableName, nil
+	}
+	return "", "", fmt.Errorf("多次生成的任务ID均已被占用")
+}
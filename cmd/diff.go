@@ -0,0 +1,69 @@
+package main
+
+import (
+	"cyberspace_mapping_summary/internal/analysis"
+	"cyberspace_mapping_summary/internal/util"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runDiff 对比两个任务并导出差异CSV与摘要文本
+func runDiff(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan diff <任务A> <任务B>")
+		return 1
+	}
+
+	store, err := openCommandStorage()
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	oldTable, err := resolveTask(store, args[0])
+	if err != nil {
+		log.Printf("[!] %v", err)
+		return 1
+	}
+	newTable, err := resolveTask(store, args[1])
+	if err != nil {
+		log.Printf("[!] %v", err)
+		return 1
+	}
+
+	diff, err := analysis.DiffTasks(store, oldTable, newTable)
+	if err != nil {
+		log.Printf("[!] 任务对比失败: %v", err)
+		return 1
+	}
+
+	resultsDir := filepath.Join("results", "diff")
+	if err := os.MkdirAll(resultsDir, 0755); err != nil {
+		log.Printf("[!] 创建结果目录失败: %v", err)
+		return 1
+	}
+
+	diffID := strings.TrimPrefix(oldTable, "task_") + "_vs_" + strings.TrimPrefix(newTable, "task_")
+	csvPath := filepath.Join(resultsDir, util.GenerateCSVFileName(diffID, "diff"))
+	if err := analysis.ExportTaskDiff(diff, csvPath); err != nil {
+		log.Printf("[!] 导出差异明细失败: %v", err)
+		return 1
+	}
+	txtPath := filepath.Join(resultsDir, util.GenerateTXTFileName(diffID, "diff"))
+	if err := analysis.WriteTaskDiffSummary(diff, txtPath); err != nil {
+		log.Printf("[!] 导出差异摘要失败: %v", err)
+		return 1
+	}
+
+	fmt.Printf("[*] 任务对比: %s -> %s\n", oldTable, newTable)
+	fmt.Printf("[*] 新增资产 %d 个，消失资产 %d 个，变化资产 %d 个\n",
+		diff.Count(analysis.ChangeNew), diff.Count(analysis.ChangeDisappeared), diff.Count(analysis.ChangeChanged))
+	fmt.Printf("[*] 新增IP %d 个，消失IP %d 个\n", len(diff.NewIPs), len(diff.DisappearedIPs))
+	fmt.Println("[*] 差异明细:", csvPath)
+	fmt.Println("[*] 差异摘要:", txtPath)
+	return 0
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"cyberspace_mapping_summary/internal/config"
+	"cyberspace_mapping_summary/internal/database"
+	"cyberspace_mapping_summary/internal/importer"
+	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/ranges"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// runImport 导入外部工具的扫描结果：写入新任务，或以 -task 追加到已有任务，与测绘结果按同一规则去重合并
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "文件格式: "+strings.Join(importer.Formats, " / "))
+	unit := fs.String("unit", "", "结果归属的单位代号，多个单位以分号分隔")
+	task := fs.String("task", "", "追加到已有任务（任务ID、任务表名或项目名称），默认新建任务")
+	name := fs.String("name", "", "新任务的项目名称")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan import -format 格式 -unit 单位 [-task 任务 | -name 项目名称] <文件...>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() == 0 || *format == "" || strings.TrimSpace(*unit) == "" {
+		fs.Usage()
+		return 1
+	}
+	if *task != "" && *name != "" {
+		log.Printf("[!] -task 与 -name 不能同时使用，追加到已有任务时可用 rename 修改项目名称")
+		return 1
+	}
+
+	// 先解析全部文件，格式有误时不创建任务
+	var results []model.QueryResult
+	source := strings.ToLower(*format)
+	for _, path := range fs.Args() {
+		fileResults, err := importer.ImportFile(source, path, strings.TrimSpace(*unit))
+		if err != nil {
+			log.Printf("[!] %v", err)
+			return 1
+		}
+		fmt.Printf("[*] %s: %d 条结果\n", path, len(fileResults))
+		results = append(results, fileResults...)
+	}
+	if len(results) == 0 {
+		fmt.Println("[*] 文件中没有可导入的结果")
+		return 0
+	}
+
+	cfg, err := config.ReadConfig("config.yaml")
+	if err != nil {
+		log.Printf("[!] 读取配置失败: %v", err)
+		return 1
+	}
+	store, err := openStorage(cfg)
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	var tableName string
+	var rec *database.TaskRecord
+	if *task != "" {
+		if tableName, err = resolveTask(store, *task); err != nil {
+			log.Printf("[!] %v", err)
+			return 1
+		}
+		if err := store.LockTask(tableName); err != nil {
+			log.Printf("[!] %v", err)
+			return 1
+		}
+		defer store.UnlockTask(tableName)
+		if rec, err = database.LoadTaskRecord(store, tableName); err != nil {
+			log.Printf("[!] 读取任务元数据失败: %v", err)
+			return 1
+		}
+	} else {
+		taskID, newTable, err := claimTask(store)
+		if err != nil {
+			log.Printf("[!] 分配任务ID失败: %v", err)
+			return 1
+		}
+		tableName = newTable
+		defer store.UnlockTask(tableName)
+
+		if err := store.InitTask(tableName, database.TaskOptions{
+			Identity:  cfg.Dedup.Identity,
+			Merge:     cfg.Dedup.Merge,
+			Fields:    cfg.Dedup.Fields,
+			Providers: cfg.Dedup.Providers,
+		}); err != nil {
+			log.Printf("[!] 创建任务表失败: %v", err)
+			return 1
+		}
+		rec = &database.TaskRecord{
+			TaskID:     taskID,
+			TableName:  tableName,
+			Name:       *name,
+			Status:     database.TaskStatusRunning,
+			Owner:      currentOwner(),
+			StartedAt:  time.Now().Format("2006-01-02 15:04:05"),
+			TargetFile: strings.Join(fs.Args(), ";"),
+		}
+		if fs.NArg() == 1 {
+			rec.TargetSHA256, _ = fileSHA256(fs.Arg(0))
+		}
+		if err := store.SaveTaskRecord(*rec); err != nil {
+			log.Printf("[!] 保存任务元数据失败: %v", err)
+		}
+	}
+
+	// 与测绘流程一致，按本地网段库标记IP所属的CDN或云厂商
+	ipRanges, err := ranges.Load(rangesFile(cfg))
+	if err != nil {
+		log.Printf("[!] 加载CDN与云厂商网段库失败，结果将不标记IP所属厂商: %v", err)
+	}
+	ipRanges.Tag(results)
+
+	writer := database.NewResultWriter(store, tableName, cfg.Database.BatchSize, time.Duration(cfg.Database.FlushIntervalSeconds)*time.Second)
+	writer.Write(results)
+	_, saved, saveErr := writer.Close()
+
+	// 入库后把导入的资产合并进跨任务清单；导入结果只是单位资产的一部分，不据此标记其他资产消失
+	var invStats database.InventoryStats
+	var invErr error
+	if saveErr == nil {
+		invStats, invErr = store.UpdateInventory(tableName, strings.TrimPrefix(tableName, "task_"), false)
+	}
+
+	// 导入来源与结果数记入任务元数据，与测绘平台并列
+	if rec != nil {
+		if !containsString(rec.Providers, source) {
+			rec.Providers = append(rec.Providers, source)
+		}
+		if rec.ProviderCounts == nil {
+			rec.ProviderCounts = make(map[string]int)
+		}
+		rec.ProviderCounts[source] += saved
+		now := time.Now().Format("2006-01-02 15:04:05")
+		if *task == "" {
+			rec.FinishedAt = now
+			rec.Status = database.TaskStatusCompleted
+		}
+		if saveErr != nil {
+			rec.Errors = append(rec.Errors, database.TaskError{Time: now, Stage: "import", Provider: source, Message: saveErr.Error()})
+			if *task == "" {
+				rec.Status = database.TaskStatusFailed
+			}
+		}
+		if invErr != nil {
+			rec.Errors = append(rec.Errors, database.TaskError{Time: now, Stage: "inventory", Message: invErr.Error()})
+		}
+		if err := store.SaveTaskRecord(*rec); err != nil {
+			log.Printf("[!] 保存任务元数据失败: %v", err)
+		}
+	}
+	if saveErr != nil {
+		log.Printf("[!] 导入结果入库失败: %v", saveErr)
+		return 1
+	}
+
+	summary, err := database.GetTaskSummary(store, tableName)
+	if err != nil {
+		log.Printf("[!] 统计任务失败: %v", err)
+		return 1
+	}
+	fmt.Printf("[+] 已导入 %d 条 %s 结果到任务 %s（Web资产 %d 个，非web服务 %d 个，待验证域名 %d 个）\n",
+		saved, source, summary.TaskID, summary.WebAssets, summary.Services, summary.Domains)
+	if invErr != nil {
+		log.Printf("[!] 更新资产清单失败: %v", invErr)
+		return 1
+	}
+	fmt.Printf("[*] 资产清单已更新: 本次发现 %d 个，新增 %d 个\n", invStats.Seen, invStats.New)
+	return 0
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
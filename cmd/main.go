@@ -8,6 +8,7 @@ import (
 	"cyberspace_mapping_summary/internal/loader"
 	"cyberspace_mapping_summary/internal/model"
 	"cyberspace_mapping_summary/internal/query"
+	"cyberspace_mapping_summary/internal/ranges"
 	"cyberspace_mapping_summary/internal/util"
 	"fmt"
 	"log"
@@ -17,7 +18,15 @@ import (
 	"time"
 )
 
+// defaultDBPath 默认结果数据库路径（未配置 database.path 时）
+const defaultDBPath = "res.db"
+
 func main() {
+	// 子命令（diff等）直接操作结果数据库，不带参数时执行完整测绘流程
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	// 1. 读取配置
 	cfg, shouldExit, err := config.LoadConfig("config.yaml")
 	if err != nil {
@@ -28,18 +37,47 @@ func main() {
 		os.Exit(0)
 	}
 
+	// CDN与云厂商网段库，用于标记结果IP所属厂商并识别共享网段；读取失败时不做标记
+	ipRanges, err := ranges.Load(rangesFile(cfg))
+	if err != nil {
+		log.Printf("[!] 加载CDN与云厂商网段库失败，结果将不标记IP所属厂商: %v", err)
+	}
+
 	// 定义查询间隔时间（秒）
 	queryInterval := time.Duration(cfg.Query.IntervalSeconds) * time.Second
 
-	// 2. 生成任务ID和结果目录
-	taskID := util.GenerateTaskID()
-	projectDir := util.GenerateProjectDir(cfg.Output.BaseDir)
+	// 各平台查询配置（API Key + 请求定制项）
+	fofaCfg := query.FofaConfig{APIKey: cfg.APIKeys.FOFA, Fields: cfg.Query.FofaFields, ProviderOptions: providerOptions(cfg.Providers.FOFA)}
+	quakeCfg := query.QuakeConfig{APIKey: cfg.APIKeys.Quake, ProviderOptions: providerOptions(cfg.Providers.Quake)}
+	hunterCfg := query.HunterConfig{APIKey: cfg.APIKeys.Hunter, ProviderOptions: providerOptions(cfg.Providers.Hunter)}
+
+	// 2. 打开数据库，生成任务ID并占用任务锁，创建结果目录
+	store, err := openStorage(cfg)
+	if err != nil {
+		log.Fatalf("数据库初始化失败: %v", err)
+	}
+	defer store.Close()
+
+	taskID, tableName, err := claimTask(store)
+	if err != nil {
+		log.Fatalf("分配任务ID失败: %v", err)
+	}
+	defer store.UnlockTask(tableName)
+	fmt.Printf("[+] 任务ID: %s\n", taskID)
+
+	projectDir := util.GenerateProjectDir(taskID)
 	resultsDir := filepath.Join("results", projectDir)
 	if err := os.MkdirAll(resultsDir, 0755); err != nil {
 		log.Fatalf("创建结果目录失败: %v", err)
 	}
 	fmt.Printf("[+] 项目结果将保存在: %s\n", resultsDir)
 
+	// 记录任务元数据（tasks 表与结果目录下的 manifest.json），查询客户端逐页上报积分消耗
+	run := newTaskRun(store, cfg, taskID, tableName, resultsDir)
+	fofaCfg.OnPage = run.onPage
+	quakeCfg.OnPage = run.onPage
+	hunterCfg.OnPage = run.onPage
+
 	// 3. 读取目标（csv，带单位）
 	targetFile := "targets.csv"
 	if cfg.Input.TargetFile != "" {
@@ -47,8 +85,9 @@ func main() {
 	}
 	targets, err := loader.ReadTargetsFromCSV(targetFile)
 	if err != nil {
-		log.Fatalf("读取目标文件失败: %v", err)
+		run.fatalf("读取目标文件失败: %v", err)
 	}
+	run.setTargets(targetFile, targets)
 	fmt.Printf("[*] 共加载目标: %d 条\n", len(targets))
 
 	// 4. 验证域名/IP有效性
@@ -60,17 +99,27 @@ func main() {
 	}
 	fmt.Printf("[*] 有效目标: %d 条\n", len(validTargets))
 	if len(validTargets) == 0 {
-		log.Fatalf("无有效目标，退出")
+		run.fatalf("无有效目标，退出")
 	}
 
-	// 5. 并发查询三大测绘平台
-	allResults := make([]model.QueryResult, 0)
-	var allResultsMutex sync.Mutex
+	// 5. 初始化任务表，查询结果边查询边分批入库
+	if err := store.InitTask(tableName, database.TaskOptions{
+		Identity:  cfg.Dedup.Identity,
+		Merge:     cfg.Dedup.Merge,
+		Fields:    cfg.Dedup.Fields,
+		Providers: cfg.Dedup.Providers,
+	}); err != nil {
+		run.fatalf("创建任务表失败: %v", err)
+	}
+
+	writer := database.NewResultWriter(store, tableName, cfg.Database.BatchSize, time.Duration(cfg.Database.FlushIntervalSeconds)*time.Second)
+
+	// 6. 并发查询三大测绘平台
 	var wg sync.WaitGroup
 
 	// 检查API Key配置
 	if cfg.APIKeys.Quake == "" && cfg.APIKeys.FOFA == "" && cfg.APIKeys.Hunter == "" {
-		log.Fatalf("未配置任何API Key，无法进行查询")
+		run.fatalf("未配置任何API Key，无法进行查询")
 	}
 
 	// Quake查询协程
@@ -79,30 +128,31 @@ func main() {
 		go func() {
 			defer wg.Done()
 			fmt.Println("[*] 开始Quake查询...")
-			quakeResults := make([]model.QueryResult, 0)
+			quakeCount := 0
 
 			for _, t := range validTargets {
-				results, err := query.QueryQuake(t.Host, cfg.APIKeys.Quake)
+				results, err := query.QueryQuake(t.Host, quakeCfg)
 				if err != nil {
 					log.Printf("[!] Quake查询 %s 失败: %v", t.Host, err)
+					run.addError("query", "quake", t.Host, err)
 					continue
 				}
-				// 补充单位归属
+				// 补充单位归属及其依据
 				for i := range results {
 					results[i].Unit = t.Unit
+					results[i].Target = t.Host
+					results[i].TargetRow = t.Row
 				}
-				quakeResults = append(quakeResults, results...)
+				ipRanges.Tag(results)
+				writer.Write(results)
+				quakeCount += len(results)
+				run.addResults("quake", len(results))
 
 				// 每轮查询后sleep
 				time.Sleep(queryInterval)
 			}
 
-			// 线程安全地添加结果
-			allResultsMutex.Lock()
-			allResults = append(allResults, quakeResults...)
-			allResultsMutex.Unlock()
-
-			fmt.Printf("[*] Quake查询完成，结果数: %d 条\n", len(quakeResults))
+			fmt.Printf("[*] Quake查询完成，结果数: %d 条\n", quakeCount)
 		}()
 	} else {
 		fmt.Println("[*] 未配置Quake API Key，跳过Quake查询")
@@ -114,30 +164,31 @@ func main() {
 		go func() {
 			defer wg.Done()
 			fmt.Println("[*] 开始FOFA查询...")
-			fofaResults := make([]model.QueryResult, 0)
+			fofaCount := 0
 
 			for _, t := range validTargets {
-				results, err := query.QueryFofa(t.Host, cfg.APIKeys.FOFA)
+				results, err := query.QueryFofa(t.Host, fofaCfg)
 				if err != nil {
 					log.Printf("[!] FOFA查询 %s 失败: %v", t.Host, err)
+					run.addError("query", "fofa", t.Host, err)
 					continue
 				}
-				// 补充单位归属
+				// 补充单位归属及其依据
 				for i := range results {
 					results[i].Unit = t.Unit
+					results[i].Target = t.Host
+					results[i].TargetRow = t.Row
 				}
-				fofaResults = append(fofaResults, results...)
+				ipRanges.Tag(results)
+				writer.Write(results)
+				fofaCount += len(results)
+				run.addResults("fofa", len(results))
 
 				// 每轮查询后sleep
 				time.Sleep(queryInterval)
 			}
 
-			// 线程安全地添加结果
-			allResultsMutex.Lock()
-			allResults = append(allResults, fofaResults...)
-			allResultsMutex.Unlock()
-
-			fmt.Printf("[*] FOFA查询完成，结果数: %d 条\n", len(fofaResults))
+			fmt.Printf("[*] FOFA查询完成，结果数: %d 条\n", fofaCount)
 		}()
 	} else {
 		fmt.Println("[*] 未配置FOFA API Key，跳过FOFA查询")
@@ -149,30 +200,31 @@ func main() {
 		go func() {
 			defer wg.Done()
 			fmt.Println("[*] 开始Hunter查询...")
-			hunterResults := make([]model.QueryResult, 0)
+			hunterCount := 0
 
 			for _, t := range validTargets {
-				results, err := query.QueryHunter(t.Host, cfg.APIKeys.Hunter)
+				results, err := query.QueryHunter(t.Host, hunterCfg)
 				if err != nil {
 					log.Printf("[!] Hunter查询 %s 失败: %v", t.Host, err)
+					run.addError("query", "hunter", t.Host, err)
 					continue
 				}
-				// 补充单位归属
+				// 补充单位归属及其依据
 				for i := range results {
 					results[i].Unit = t.Unit
+					results[i].Target = t.Host
+					results[i].TargetRow = t.Row
 				}
-				hunterResults = append(hunterResults, results...)
+				ipRanges.Tag(results)
+				writer.Write(results)
+				hunterCount += len(results)
+				run.addResults("hunter", len(results))
 
 				// 每轮查询后sleep
 				time.Sleep(queryInterval)
 			}
 
-			// 线程安全地添加结果
-			allResultsMutex.Lock()
-			allResults = append(allResults, hunterResults...)
-			allResultsMutex.Unlock()
-
-			fmt.Printf("[*] Hunter查询完成，结果数: %d 条\n", len(hunterResults))
+			fmt.Printf("[*] Hunter查询完成，结果数: %d 条\n", hunterCount)
 		}()
 	} else {
 		fmt.Println("[*] 未配置Hunter API Key，跳过Hunter查询")
@@ -181,69 +233,107 @@ func main() {
 	// 等待所有协程完成
 	fmt.Println("[*] 等待所有查询完成...")
 	wg.Wait()
-	fmt.Printf("[*] 所有查询完成，总结果数: %d 条\n", len(allResults))
-
-	// 8. 初始化数据库和表
-	dbPath := "res.db"
-	tableName := util.GenerateTableName(taskID)
-	db, err := database.InitDB(dbPath, tableName)
-	if err != nil {
-		log.Fatalf("数据库初始化失败: %v", err)
-	}
-	defer db.Close()
 
-	// 9. 去重并保存到sqlite
-	err = database.SaveResults(db, tableName, allResults)
+	// 7. 写完剩余结果（去重合并在入库时完成）
+	received, saved, err := writer.Close()
+	fmt.Printf("[*] 所有查询完成，总结果数: %d 条\n", received)
 	if err != nil {
-		log.Fatalf("数据保存失败: %v", err)
+		// 已提交的批次保留在库中，继续统计与导出，失败记入任务元数据
+		log.Printf("[!] 部分结果保存失败: %v", err)
+		run.addError("save", "", "", err)
 	}
-	fmt.Println("[*] 数据已保存到sqlite")
+	fmt.Printf("[*] 数据已入库: %d 条\n", saved)
 
 	// 查询去重后的数据数量
 	var count int
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", tableName)
-	err = db.QueryRow(countQuery).Scan(&count)
+	err = store.QueryRow(countQuery).Scan(&count)
 	if err != nil {
 		log.Printf("[!] 查询数据数量失败: %v", err)
 	} else {
 		fmt.Printf("[*] 去重后数据数量: %d 条\n", count)
 	}
+	serviceTable := database.ServiceTableName(tableName)
+	countQuery = fmt.Sprintf("SELECT COUNT(*) FROM %s", serviceTable)
+	if err := store.QueryRow(countQuery).Scan(&count); err != nil {
+		log.Printf("[!] 查询服务数量失败: %v", err)
+	} else {
+		fmt.Printf("[*] 非web服务数量: %d 条\n", count)
+	}
 
 	// 10. 导出第一轮结果
 	csvFileName := util.GenerateCSVFileName(taskID, "step1")
 	outputPath := filepath.Join(resultsDir, csvFileName)
-	err = exporter.ExportTableToCSV(db, tableName, outputPath)
+	err = exporter.ExportTableToCSV(store, tableName, outputPath)
 	if err != nil {
-		log.Fatalf("导出csv失败: %v", err)
+		run.fatalf("导出csv失败: %v", err)
 	}
+	run.addOutput(outputPath)
 	fmt.Println("[*] 已导出第一轮结果到:", outputPath)
 
+	servicesPath := filepath.Join(resultsDir, util.GenerateCSVFileName(taskID, "step1_services"))
+	if err := exporter.ExportServicesToCSV(store, serviceTable, servicesPath); err != nil {
+		log.Printf("[!] 导出非web服务失败: %v", err)
+		run.addError("export", "", "", err)
+	} else {
+		run.addOutput(servicesPath)
+		fmt.Println("[*] 已导出第一轮非web服务到:", servicesPath)
+	}
+
 	// 11. C段分析与第二轮查询
 	if cfg.Query.MinIPsPerCIDR == -1 {
 		fmt.Println("[*] 配置为跳过第二轮扫描，跳过C段分析")
 	} else {
 		fmt.Println("[*] 开始C段分析...")
-		cSegmentInfos, err := analysis.CSegmentAnalysis(db, tableName, cfg.Query.MinIPsPerCIDR)
+		cSegmentInfos, err := analysis.CSegmentAnalysis(store, tableName, cfg.Query.MinIPsPerCIDR, cidrOptions(cfg), ipRanges)
 		if err != nil {
 			log.Printf("[!] C段分析失败: %v", err)
+			run.addError("analysis", "", "", err)
 		} else if len(cSegmentInfos) > 0 {
 			fmt.Printf("[*] 发现 %d 个高密度C段，开始第二轮查询\n", len(cSegmentInfos))
 
 			// 生成第二轮查询目标，过滤掉第一轮已查询的C段
-			secondRoundTargets := analysis.GenerateSecondRoundTargets(cSegmentInfos, validTargets)
+			secondRoundTargets := analysis.GenerateSecondRoundTargets(cSegmentInfos, validTargets, cfg.Query.SharedCIDR)
 			fmt.Printf("[*] 第二轮查询目标: %d 个\n", len(secondRoundTargets))
 
 			// 获取第一轮查询中已存在的IP列表，用于reliability判断
-			existingIPs, err := database.GetExistingIPs(db, tableName)
+			existingIPs, err := store.GetExistingIPs(tableName)
 			if err != nil {
 				log.Printf("[!] 获取已存在IP列表失败: %v", err)
 				existingIPs = make(map[string]bool) // 使用空map作为fallback
 			}
 			fmt.Printf("[*] 第一轮查询中已存在 %d 个IP\n", len(existingIPs))
 
-			// 第二轮查询结果
-			secondRoundResults := make([]model.QueryResult, 0)
-			var secondRoundMutex sync.Mutex
+			// shared_cidr 为 separate 时，共享网段中新发现的IP不记入单位资产，单独导出
+			sharedCIDRs := make(map[string]string)
+			if cfg.Query.SharedCIDR == analysis.SharedCIDRSeparate {
+				for _, info := range cSegmentInfos {
+					if info.Provider != "" {
+						sharedCIDRs[info.CIDR] = info.Provider
+					}
+				}
+			}
+			var sharedMu sync.Mutex
+			var sharedResults []model.QueryResult
+			divertShared := func(t model.TargetEntry, results []model.QueryResult) []model.QueryResult {
+				if sharedCIDRs[t.Host] == "" {
+					return results
+				}
+				var kept []model.QueryResult
+				sharedMu.Lock()
+				defer sharedMu.Unlock()
+				for _, r := range results {
+					if r.Reliability == 2 {
+						sharedResults = append(sharedResults, r)
+					} else {
+						kept = append(kept, r)
+					}
+				}
+				return kept
+			}
+
+			// 第二轮查询结果同样边查询边分批入库（自动去重）
+			secondWriter := database.NewResultWriter(store, tableName, cfg.Database.BatchSize, time.Duration(cfg.Database.FlushIntervalSeconds)*time.Second)
 			var secondRoundWg sync.WaitGroup
 
 			// 执行第二轮查询（多协程并发）
@@ -252,17 +342,20 @@ func main() {
 				go func() {
 					defer secondRoundWg.Done()
 					fmt.Println("[*] 开始第二轮Quake查询...")
-					quakeResults := make([]model.QueryResult, 0)
+					quakeCount := 0
 
 					for _, t := range secondRoundTargets {
-						results, err := query.QueryQuake(t.Host, cfg.APIKeys.Quake)
+						results, err := query.QueryQuake(t.Host, quakeCfg)
 						if err != nil {
 							log.Printf("[!] 第二轮Quake查询 %s 失败: %v", t.Host, err)
+							run.addError("query", "quake", t.Host, err)
 							continue
 						}
 						// 根据IP是否已存在动态设置reliability
 						for i := range results {
 							results[i].Unit = t.Unit
+							results[i].Target = t.Host
+							results[i].TargetRow = t.Row
 							// 检查IP是否在第一轮中已存在
 							if existingIPs[results[i].IP] {
 								results[i].Reliability = 1 // IP已存在，reliability=1
@@ -270,16 +363,15 @@ func main() {
 								results[i].Reliability = 2 // 新IP，reliability=2
 							}
 						}
-						quakeResults = append(quakeResults, results...)
+						ipRanges.Tag(results)
+						results = divertShared(t, results)
+						secondWriter.Write(results)
+						quakeCount += len(results)
+						run.addResults("quake", len(results))
 						time.Sleep(queryInterval)
 					}
 
-					// 线程安全地添加结果
-					secondRoundMutex.Lock()
-					secondRoundResults = append(secondRoundResults, quakeResults...)
-					secondRoundMutex.Unlock()
-
-					fmt.Printf("[*] 第二轮Quake查询完成，结果数: %d 条\n", len(quakeResults))
+					fmt.Printf("[*] 第二轮Quake查询完成，结果数: %d 条\n", quakeCount)
 				}()
 			}
 
@@ -288,17 +380,20 @@ func main() {
 				go func() {
 					defer secondRoundWg.Done()
 					fmt.Println("[*] 开始第二轮FOFA查询...")
-					fofaResults := make([]model.QueryResult, 0)
+					fofaCount := 0
 
 					for _, t := range secondRoundTargets {
-						results, err := query.QueryFofa(t.Host, cfg.APIKeys.FOFA)
+						results, err := query.QueryFofa(t.Host, fofaCfg)
 						if err != nil {
 							log.Printf("[!] 第二轮FOFA查询 %s 失败: %v", t.Host, err)
+							run.addError("query", "fofa", t.Host, err)
 							continue
 						}
 						// 根据IP是否已存在动态设置reliability
 						for i := range results {
 							results[i].Unit = t.Unit
+							results[i].Target = t.Host
+							results[i].TargetRow = t.Row
 							// 检查IP是否在第一轮中已存在
 							if existingIPs[results[i].IP] {
 								results[i].Reliability = 1 // IP已存在，reliability=1
@@ -306,16 +401,15 @@ func main() {
 								results[i].Reliability = 2 // 新IP，reliability=2
 							}
 						}
-						fofaResults = append(fofaResults, results...)
+						ipRanges.Tag(results)
+						results = divertShared(t, results)
+						secondWriter.Write(results)
+						fofaCount += len(results)
+						run.addResults("fofa", len(results))
 						time.Sleep(queryInterval)
 					}
 
-					// 线程安全地添加结果
-					secondRoundMutex.Lock()
-					secondRoundResults = append(secondRoundResults, fofaResults...)
-					secondRoundMutex.Unlock()
-
-					fmt.Printf("[*] 第二轮FOFA查询完成，结果数: %d 条\n", len(fofaResults))
+					fmt.Printf("[*] 第二轮FOFA查询完成，结果数: %d 条\n", fofaCount)
 				}()
 			}
 
@@ -324,17 +418,20 @@ func main() {
 				go func() {
 					defer secondRoundWg.Done()
 					fmt.Println("[*] 开始第二轮Hunter查询...")
-					hunterResults := make([]model.QueryResult, 0)
+					hunterCount := 0
 
 					for _, t := range secondRoundTargets {
-						results, err := query.QueryHunter(t.Host, cfg.APIKeys.Hunter)
+						results, err := query.QueryHunter(t.Host, hunterCfg)
 						if err != nil {
 							log.Printf("[!] 第二轮Hunter查询 %s 失败: %v", t.Host, err)
+							run.addError("query", "hunter", t.Host, err)
 							continue
 						}
 						// 根据IP是否已存在动态设置reliability
 						for i := range results {
 							results[i].Unit = t.Unit
+							results[i].Target = t.Host
+							results[i].TargetRow = t.Row
 							// 检查IP是否在第一轮中已存在
 							if existingIPs[results[i].IP] {
 								results[i].Reliability = 1 // IP已存在，reliability=1
@@ -342,53 +439,95 @@ func main() {
 								results[i].Reliability = 2 // 新IP，reliability=2
 							}
 						}
-						hunterResults = append(hunterResults, results...)
+						ipRanges.Tag(results)
+						results = divertShared(t, results)
+						secondWriter.Write(results)
+						hunterCount += len(results)
+						run.addResults("hunter", len(results))
 						time.Sleep(queryInterval)
 					}
 
-					// 线程安全地添加结果
-					secondRoundMutex.Lock()
-					secondRoundResults = append(secondRoundResults, hunterResults...)
-					secondRoundMutex.Unlock()
-
-					fmt.Printf("[*] 第二轮Hunter查询完成，结果数: %d 条\n", len(hunterResults))
+					fmt.Printf("[*] 第二轮Hunter查询完成，结果数: %d 条\n", hunterCount)
 				}()
 			}
 
 			// 等待所有第二轮查询协程完成
 			fmt.Println("[*] 等待所有第二轮查询完成...")
 			secondRoundWg.Wait()
-			fmt.Printf("[*] 所有第二轮查询完成，总结果数: %d 条\n", len(secondRoundResults))
 
-			// 保存第二轮结果到数据库（自动去重）
-			if len(secondRoundResults) > 0 {
-				err = database.SaveResults(db, tableName, secondRoundResults)
-				if err != nil {
-					log.Printf("[!] 保存第二轮结果失败: %v", err)
-				} else {
-					fmt.Printf("[*] 第二轮查询完成，新增结果: %d 条\n", len(secondRoundResults))
-				}
+			received, saved, err := secondWriter.Close()
+			fmt.Printf("[*] 所有第二轮查询完成，总结果数: %d 条\n", received)
+			if err != nil {
+				log.Printf("[!] 保存第二轮结果失败: %v", err)
+				run.addError("save", "", "", err)
+			} else {
+				fmt.Printf("[*] 第二轮查询完成，新增结果: %d 条\n", saved)
 			}
 
 			// 导出第二轮结果
 			secondRoundCSV := util.GenerateCSVFileName(taskID, "step2")
 			secondRoundPath := filepath.Join(resultsDir, secondRoundCSV)
-			err = exporter.ExportTableToCSV(db, tableName, secondRoundPath)
+			err = exporter.ExportTableToCSV(store, tableName, secondRoundPath)
 			if err != nil {
 				log.Printf("[!] 导出第二轮结果失败: %v", err)
+				run.addError("export", "", "", err)
 			} else {
+				run.addOutput(secondRoundPath)
 				fmt.Println("[*] 已导出第二轮结果到:", secondRoundPath)
 			}
+
+			secondServicesPath := filepath.Join(resultsDir, util.GenerateCSVFileName(taskID, "step2_services"))
+			if err := exporter.ExportServicesToCSV(store, serviceTable, secondServicesPath); err != nil {
+				log.Printf("[!] 导出第二轮非web服务失败: %v", err)
+				run.addError("export", "", "", err)
+			} else {
+				run.addOutput(secondServicesPath)
+				fmt.Println("[*] 已导出第二轮非web服务到:", secondServicesPath)
+			}
+
+			if len(sharedCIDRs) > 0 {
+				sharedPath := filepath.Join(resultsDir, util.GenerateCSVFileName(taskID, "step2_shared"))
+				if err := exporter.ExportSharedResultsToCSV(sharedResults, sharedCIDRs, sharedPath); err != nil {
+					log.Printf("[!] 导出共享网段结果失败: %v", err)
+					run.addError("export", "", "", err)
+				} else {
+					run.addOutput(sharedPath)
+					fmt.Printf("[*] 已导出共享网段中新发现的 %d 条结果（未记入单位资产）到: %s\n", len(sharedResults), sharedPath)
+				}
+			}
 		} else {
 			fmt.Println("[*] 未发现高密度C段，跳过第二轮查询")
 		}
 	}
 
+	// 资产归属明细：共享资产在每个单位下各出一行，附带归属依据
+	ownershipPath := filepath.Join(resultsDir, util.GenerateCSVFileName(taskID, "ownership"))
+	if err := exporter.ExportOwnershipToCSV(store, tableName, ownershipPath); err != nil {
+		log.Printf("[!] 导出资产归属明细失败: %v", err)
+		run.addError("export", "", "", err)
+	} else {
+		run.addOutput(ownershipPath)
+		fmt.Println("[*] 已导出资产归属明细到:", ownershipPath)
+	}
+
+	// 网段分层汇总：按cidr_rollup / cidr_rollup_v6逐层统计IP分布，便于判断单位的自然网段
+	if len(cfg.Query.CIDRRollup) > 0 || len(cfg.Query.CIDRRollupV6) > 0 {
+		rollupPath := filepath.Join(resultsDir, util.GenerateCSVFileName(taskID, "cidr_rollup"))
+		if err := exporter.ExportCIDRRollupToCSV(store, tableName, cfg.Query.CIDRRollup, cfg.Query.CIDRRollupV6, rollupPath); err != nil {
+			log.Printf("[!] 导出网段分层汇总失败: %v", err)
+			run.addError("export", "", "", err)
+		} else {
+			run.addOutput(rollupPath)
+			fmt.Println("[*] 已导出网段分层汇总到:", rollupPath)
+		}
+	}
+
 	// 12. IP业务数量分析
 	fmt.Println("[*] 开始IP业务数量分析...")
-	ipResults, err := analysis.AnalyzeIPBusinessCount(db, tableName, cfg.Query.MinURLsPerIPForFlag)
+	ipResults, err := analysis.AnalyzeIPBusinessCount(store, tableName, cfg.Query.MinURLsPerIPForFlag)
 	if err != nil {
 		log.Printf("[!] IP业务数量分析失败: %v", err)
+		run.addError("analysis", "", "", err)
 	} else if len(ipResults) > 0 {
 		// 导出IP分析结果
 		ipAnalysisFile := util.GenerateCSVFileName(taskID, "ip_need_scan")
@@ -396,12 +535,80 @@ func main() {
 		err = analysis.ExportIPAnalysisResults(ipResults, ipAnalysisPath)
 		if err != nil {
 			log.Printf("[!] 导出IP分析结果失败: %v", err)
+			run.addError("export", "", "", err)
 		} else {
+			run.addOutput(ipAnalysisPath)
 			fmt.Printf("[*] 发现 %d 个高业务量IP，已导出到: %s\n", len(ipResults), ipAnalysisPath)
 		}
 	} else {
 		fmt.Println("[*] 未发现高业务量IP")
 	}
 
+	// 13. 更新跨任务资产清单
+	fmt.Println("[*] 开始更新跨任务资产清单...")
+	invStats, err := store.UpdateInventory(tableName, taskID, true)
+	if err != nil {
+		log.Printf("[!] 更新资产清单失败: %v", err)
+		run.addError("inventory", "", "", err)
+	} else {
+		fmt.Printf("[*] 资产清单已更新: 本次发现 %d 个，新增 %d 个，消失 %d 个\n", invStats.Seen, invStats.New, invStats.Missing)
+		inventoryPath := filepath.Join(resultsDir, util.GenerateCSVFileName(taskID, "inventory"))
+		if err := exporter.ExportInventoryToCSV(store, database.UnitTableName(tableName), taskID, inventoryPath); err != nil {
+			log.Printf("[!] 导出资产清单失败: %v", err)
+			run.addError("export", "", "", err)
+		} else {
+			run.addOutput(inventoryPath)
+			fmt.Println("[*] 已导出资产清单到:", inventoryPath)
+		}
+	}
+
+	// 查询审计：每次发往测绘平台的分页请求，作为测绘范围的留档依据
+	queriesPath := filepath.Join(resultsDir, util.GenerateCSVFileName(taskID, "queries"))
+	if err := exporter.ExportQueriesToCSV(store, tableName, queriesPath); err != nil {
+		log.Printf("[!] 导出查询审计记录失败: %v", err)
+		run.addError("export", "", "", err)
+	} else {
+		run.addOutput(queriesPath)
+		fmt.Println("[*] 已导出查询审计记录到:", queriesPath)
+	}
+
+	run.finish(database.TaskStatusCompleted)
 	fmt.Println("[✔] 主流程执行完毕")
 }
+
+// cidrOptions 将配置文件中的网段设置转换为高密度网段的聚合方式
+func cidrOptions(cfg *config.Config) database.CIDROptions {
+	opts := database.CIDROptions{
+		Mode:     cfg.Query.CIDRMode,
+		Prefix:   cfg.Query.CIDRPrefix,
+		PrefixV6: cfg.Query.CIDRPrefixV6,
+	}
+	if r := cfg.Query.CIDRAdaptiveRange; len(r) == 2 {
+		opts.MinPrefix, opts.MaxPrefix = r[0], r[1]
+	}
+	if r := cfg.Query.CIDRAdaptiveRangeV6; len(r) == 2 {
+		opts.MinPrefixV6, opts.MaxPrefixV6 = r[0], r[1]
+	}
+	return opts
+}
+
+// rangesFile 返回CDN与云厂商网段库的路径（未配置 query.ip_ranges_file 时使用默认文件）
+func rangesFile(cfg *config.Config) string {
+	if cfg.Query.IPRangesFile != "" {
+		return cfg.Query.IPRangesFile
+	}
+	return ranges.DefaultFile
+}
+
+// providerOptions 将配置文件中的平台请求定制项转换为查询参数
+func providerOptions(pc config.ProviderConfig) query.ProviderOptions {
+	return query.ProviderOptions{
+		BaseURL:            pc.BaseURL,
+		UserAgent:          pc.UserAgent,
+		Headers:            pc.Headers,
+		Timeout:            time.Duration(pc.TimeoutSeconds) * time.Second,
+		InsecureSkipVerify: pc.TLS.InsecureSkipVerify,
+		CAFile:             pc.TLS.CAFile,
+		ServerName:         pc.TLS.ServerName,
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"cyberspace_mapping_summary/internal/config"
+	"cyberspace_mapping_summary/internal/database"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// runMergeDB 将其他分析人员的 res.db 合并进本库：任务按原任务ID导入，跨任务清单按资产对齐合并
+func runMergeDB(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan mergedb <res.db...>")
+		return 1
+	}
+
+	cfg, err := config.ReadConfig("config.yaml")
+	if err != nil {
+		log.Printf("[!] 读取配置失败: %v", err)
+		return 1
+	}
+	store, err := openStorage(cfg)
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	ownPath := defaultDBPath
+	if cfg.Database.Path != "" {
+		ownPath = cfg.Database.Path
+	}
+	ownAbs, _ := filepath.Abs(ownPath)
+
+	for _, path := range args {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			log.Printf("[!] %v", err)
+			return 1
+		}
+		if store.Dialect() == database.DialectSQLite && abs == ownAbs {
+			log.Printf("[!] 不能把结果库合并进自身: %s", path)
+			return 1
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			log.Printf("[!] 读取 %s 失败: %v", path, err)
+			return 1
+		}
+		origin := fmt.Sprintf("%s (sha256 %s)", abs, sum)
+
+		stats, err := mergeDatabaseFile(store, path, origin)
+		if err != nil {
+			log.Printf("[!] 合并 %s 失败: %v", path, err)
+			return 1
+		}
+		fmt.Printf("[+] %s: 导入任务 %d 个（%d 条结果），已存在跳过 %d 个；清单新增资产 %d 个，更新 %d 个\n",
+			path, len(stats.Tasks), stats.Results, len(stats.Skipped), stats.InventoryNew, stats.InventoryUpdated)
+		for _, t := range stats.Tasks {
+			fmt.Println("    导入:", t)
+		}
+		for _, t := range stats.Skipped {
+			fmt.Println("    跳过:", t)
+		}
+	}
+	return 0
+}
+
+// mergeDatabaseFile 打开来源库的临时副本并合并：旧版本的库在副本上升级结构，来源文件本身不做任何修改
+func mergeDatabaseFile(store database.Storage, path, origin string) (database.DatabaseMergeStats, error) {
+	tmpDir, err := os.MkdirTemp("", "cyberscan-mergedb-")
+	if err != nil {
+		return database.DatabaseMergeStats{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	copyPath := filepath.Join(tmpDir, "res.db")
+	if err := copyFile(path, copyPath); err != nil {
+		return database.DatabaseMergeStats{}, err
+	}
+	// 来源库未正常关闭时，最近写入的数据还在WAL文件中
+	if _, err := os.Stat(path + "-wal"); err == nil {
+		if err := copyFile(path+"-wal", copyPath+"-wal"); err != nil {
+			return database.DatabaseMergeStats{}, err
+		}
+	}
+
+	src, err := database.OpenDB(copyPath)
+	if err != nil {
+		return database.DatabaseMergeStats{}, err
+	}
+	defer src.Close()
+
+	return store.MergeDatabase(src, origin)
+}
+
+// copyFile 复制文件
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
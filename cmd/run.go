@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/sha256"
+	"cyberspace_mapping_summary/internal/config"
+	"cyberspace_mapping_summary/internal/database"
+	"cyberspace_mapping_summary/internal/exporter"
+	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/query"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestFileName 结果目录下的任务清单文件
+const manifestFileName = "manifest.json"
+
+// taskRun 收集一次运行的任务元数据，查询协程并发上报，结束时写入 tasks 表与 manifest.json
+type taskRun struct {
+	mu      sync.Mutex
+	store   database.Storage
+	rec     database.TaskRecord
+	secrets []string // 错误信息中需要隐去的 API Key（请求URL可能带有 key 参数）
+}
+
+// newTaskRun 记录任务开始，配置快照中的 API Key 等敏感项已脱敏
+func newTaskRun(store database.Storage, cfg *config.Config, taskID, tableName, resultsDir string) *taskRun {
+	run := &taskRun{
+		store:   store,
+		secrets: cfg.Secrets(),
+		rec: database.TaskRecord{
+			TaskID:         taskID,
+			TableName:      tableName,
+			Name:           cfg.Task.Name,
+			Status:         database.TaskStatusRunning,
+			Owner:          currentOwner(),
+			StartedAt:      time.Now().Format("2006-01-02 15:04:05"),
+			ProviderCounts: make(map[string]int),
+			Credits:        make(map[string]int),
+			Errors:         []database.TaskError{},
+			Outputs:        []string{},
+			ResultsDir:     resultsDir,
+		},
+	}
+	snapshot, err := cfg.Snapshot()
+	if err != nil {
+		log.Printf("[!] 生成配置快照失败: %v", err)
+	}
+	run.rec.Config = snapshot
+
+	if cfg.APIKeys.FOFA != "" {
+		run.rec.Providers = append(run.rec.Providers, "fofa")
+	}
+	if cfg.APIKeys.Quake != "" {
+		run.rec.Providers = append(run.rec.Providers, "quake")
+	}
+	if cfg.APIKeys.Hunter != "" {
+		run.rec.Providers = append(run.rec.Providers, "hunter")
+	}
+	run.save()
+	return run
+}
+
+// setTargets 记录目标文件路径、SHA-256 与记录数
+func (r *taskRun) setTargets(path string, targets []model.TargetEntry) {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		log.Printf("[!] 计算目标文件哈希失败: %v", err)
+	}
+	rows := 0
+	for _, t := range targets {
+		if t.Row > rows {
+			rows = t.Row
+		}
+	}
+
+	r.mu.Lock()
+	r.rec.TargetFile = path
+	r.rec.TargetSHA256 = sum
+	r.rec.TargetRows = rows
+	r.mu.Unlock()
+	r.save()
+}
+
+// addResults 累加平台返回的原始结果数
+func (r *taskRun) addResults(provider string, n int) {
+	r.mu.Lock()
+	r.rec.ProviderCounts[provider] += n
+	r.mu.Unlock()
+}
+
+// redact 隐去文本中的 API Key
+func (r *taskRun) redact(message string) string {
+	for _, secret := range r.secrets {
+		message = strings.ReplaceAll(message, secret, "***")
+		message = strings.ReplaceAll(message, url.QueryEscape(secret), "***")
+	}
+	return message
+}
+
+// addError 记录一条错误，不中断流程
+func (r *taskRun) addError(stage, provider, target string, err error) {
+	message := r.redact(err.Error())
+
+	r.mu.Lock()
+	r.rec.Errors = append(r.rec.Errors, database.TaskError{
+		Time:     time.Now().Format("2006-01-02 15:04:05"),
+		Stage:    stage,
+		Provider: provider,
+		Target:   target,
+		Message:  message,
+	})
+	r.mu.Unlock()
+}
+
+// onPage 查询客户端每页回调：写入查询审计表并累加积分消耗
+func (r *taskRun) onPage(stat query.PageStat) {
+	r.mu.Lock()
+	r.rec.Credits[stat.Provider] += stat.Credits
+	r.mu.Unlock()
+
+	err := r.store.LogQuery(database.QueryLog{
+		TableName:  r.rec.TableName,
+		Provider:   stat.Provider,
+		Target:     stat.Target,
+		Query:      stat.Query,
+		Page:       stat.Page,
+		HTTPStatus: stat.HTTPStatus,
+		Results:    stat.Results,
+		Credits:    stat.Credits,
+		LatencyMS:  stat.Latency.Milliseconds(),
+		ErrorClass: stat.ErrorClass,
+		Error:      r.redact(stat.Error),
+		QueriedAt:  stat.Time.Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		log.Printf("[!] 写入查询审计记录失败: %v", err)
+	}
+}
+
+// addOutput 记录已生成的输出文件
+func (r *taskRun) addOutput(path string) {
+	r.mu.Lock()
+	r.rec.Outputs = append(r.rec.Outputs, path)
+	r.mu.Unlock()
+}
+
+// save 将当前元数据写入 tasks 表
+func (r *taskRun) save() {
+	r.mu.Lock()
+	rec := r.rec
+	r.mu.Unlock()
+	if err := r.store.SaveTaskRecord(rec); err != nil {
+		log.Printf("[!] 保存任务元数据失败: %v", err)
+	}
+}
+
+// finish 记录结束时间与状态，写入 manifest.json 与 tasks 表
+func (r *taskRun) finish(status string) {
+	manifestPath := filepath.Join(r.rec.ResultsDir, manifestFileName)
+
+	r.mu.Lock()
+	r.rec.Status = status
+	r.rec.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+	r.rec.Outputs = append(r.rec.Outputs, manifestPath)
+	rec := r.rec
+	r.mu.Unlock()
+
+	if err := exporter.ExportManifest(rec, manifestPath); err != nil {
+		log.Printf("[!] 写入任务清单失败: %v", err)
+	} else {
+		fmt.Println("[*] 已写入任务清单:", manifestPath)
+	}
+	r.save()
+}
+
+// fatalf 记录失败状态并释放任务锁后退出（log.Fatalf 不执行 defer）
+func (r *taskRun) fatalf(format string, args ...interface{}) {
+	err := fmt.Errorf(format, args...)
+	r.addError("fatal", "", "", err)
+	r.finish(database.TaskStatusFailed)
+	r.store.UnlockTask(r.rec.TableName)
+	r.store.Close()
+	log.Fatal(err)
+}
+
+// currentOwner 当前用户与主机，格式为 用户名@主机名
+func currentOwner() string {
+	owner, _ := os.Hostname()
+	if user := os.Getenv("USER"); user != "" {
+		owner = user + "@" + owner
+	} else if user := os.Getenv("USERNAME"); user != "" {
+		owner = user + "@" + owner
+	}
+	return owner
+}
+
+// fileSHA256 计算文件的 SHA-256
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"cyberspace_mapping_summary/internal/database"
+	"cyberspace_mapping_summary/internal/exporter"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// runSearch 在单个任务或跨任务清单中按标题、域名、主机、Server、Banner 全文搜索资产
+func runSearch(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	task := fs.String("task", "", "只搜索该任务（任务ID、任务表名或项目名称），默认搜索跨任务清单")
+	unit := fs.String("unit", "", "只返回归属该单位的资产")
+	source := fs.String("source", "", "只返回该平台发现的资产（fofa / quake / hunter）")
+	port := fs.Int("port", 0, "只返回该端口的资产")
+	reliability := fs.Int("reliability", -1, "可信度上限，如 1 只返回可信度为0、1的资产")
+	limit := fs.Int("limit", 200, "最多显示条数，0 为不限")
+	output := fs.String("o", "", "将搜索结果导出为CSV")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan search [-task 任务] [-unit 单位] [-source 平台] [-port 端口] [-reliability N] [-o 文件.csv] <关键词...>")
+		fmt.Fprintln(os.Stderr, "关键词全部命中才返回，可写为 字段:关键词 只匹配该字段（title / domain / host / server / banner），如 title:登录")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	store, err := openCommandStorage()
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	opts := database.SearchOptions{
+		Terms:          fs.Args(),
+		Unit:           *unit,
+		Source:         *source,
+		Port:           *port,
+		MaxReliability: *reliability,
+	}
+	if *task != "" {
+		if opts.TableName, err = resolveTask(store, *task); err != nil {
+			log.Printf("[!] %v", err)
+			return 1
+		}
+	}
+	// 导出时不截断
+	if *output == "" {
+		opts.Limit = *limit
+	}
+
+	hits, err := store.Search(opts)
+	if err != nil {
+		log.Printf("[!] 搜索失败: %v", err)
+		return 1
+	}
+
+	scope := "跨任务清单"
+	if opts.TableName != "" {
+		scope = "任务 " + opts.TableName
+	}
+	if len(hits) == 0 {
+		fmt.Printf("[*] %s中没有匹配的资产\n", scope)
+		return 0
+	}
+
+	if *output != "" {
+		if err := exporter.ExportSearchHits(hits, *output); err != nil {
+			log.Printf("[!] 导出搜索结果失败: %v", err)
+			return 1
+		}
+		fmt.Printf("[*] %s中匹配 %d 个资产，已导出: %s\n", scope, len(hits), *output)
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if opts.TableName == "" {
+		fmt.Fprintln(w, "单位\t资产\t标题\tServer\t来源\t可信度\t状态\t最近任务")
+	} else {
+		fmt.Fprintln(w, "单位\t资产\t标题\tServer\t来源\t可信度")
+	}
+	for _, h := range hits {
+		asset := h.URL
+		if asset == "" {
+			asset = net.JoinHostPort(h.IP, strconv.Itoa(h.Port))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d", orDash(h.OrgCode), asset, orDash(h.Title), orDash(h.Server), h.Source, h.Reliability)
+		if opts.TableName == "" {
+			fmt.Fprintf(w, "\t%s\t%s", h.Status, h.Task)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	if opts.Limit > 0 && len(hits) == opts.Limit {
+		fmt.Printf("[*] 仅显示前 %d 条，可用 -limit 0 显示全部或 -o 导出\n", opts.Limit)
+	} else {
+		fmt.Printf("[*] %s中匹配 %d 个资产\n", scope, len(hits))
+	}
+	return 0
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"cyberspace_mapping_summary/internal/database"
+	"cyberspace_mapping_summary/internal/util"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// resolveTask 将命令行中的任务（任务ID、任务表名或项目名称）解析为任务表名，任务不存在时报错
+// 任务ID / 表名优先，未找到时按项目名称查找，同名取最新任务
+func resolveTask(store database.Storage, arg string) (string, error) {
+	tableName := util.TableNameFromArg(arg)
+	exists, err := store.TaskExists(tableName)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return tableName, nil
+	}
+
+	named, err := database.FindTaskByName(store, arg)
+	if err != nil {
+		return "", err
+	}
+	if named != "" {
+		if exists, err := store.TaskExists(named); err != nil {
+			return "", err
+		} else if exists {
+			return named, nil
+		}
+	}
+	return "", fmt.Errorf("任务不存在: %s", arg)
+}
+
+// runList 列出数据库中的全部任务
+func runList(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan list")
+		return 1
+	}
+
+	store, err := openCommandStorage()
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	tasks, err := store.ListTasks()
+	if err != nil {
+		log.Printf("[!] 列出任务失败: %v", err)
+		return 1
+	}
+	if len(tasks) == 0 {
+		fmt.Println("[*] 数据库中没有任务")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "任务ID\t项目名称\t状态\t开始时间\tWeb资产\t非web服务\t观测\t单位")
+	for _, t := range tasks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+			t.TaskID, orDash(t.Name), orDash(t.Status), orDash(t.StartedAt), t.WebAssets, t.Services, t.Observations, t.Units)
+	}
+	w.Flush()
+	fmt.Printf("[*] 共 %d 个任务\n", len(tasks))
+	return 0
+}
+
+// runShow 显示单个任务的概况
+func runShow(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan show <任务>")
+		return 1
+	}
+
+	store, err := openCommandStorage()
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	tableName, err := resolveTask(store, args[0])
+	if err != nil {
+		log.Printf("[!] %v", err)
+		return 1
+	}
+	summary, err := database.GetTaskSummary(store, tableName)
+	if err != nil {
+		log.Printf("[!] 统计任务失败: %v", err)
+		return 1
+	}
+	rec, err := database.LoadTaskRecord(store, tableName)
+	if err != nil {
+		log.Printf("[!] 读取任务元数据失败: %v", err)
+		return 1
+	}
+	opts, err := database.LoadTaskOptions(store, tableName)
+	if err != nil {
+		log.Printf("[!] 读取任务选项失败: %v", err)
+		return 1
+	}
+
+	fmt.Printf("任务ID:     %s\n", summary.TaskID)
+	fmt.Printf("任务表:     %s\n", tableName)
+	fmt.Printf("项目名称:   %s\n", orDash(summary.Name))
+	fmt.Printf("状态:       %s\n", orDash(summary.Status))
+	fmt.Printf("开始时间:   %s\n", orDash(summary.StartedAt))
+	fmt.Printf("结束时间:   %s\n", orDash(summary.FinishedAt))
+	fmt.Printf("去重规则:   identity=%s merge=%s\n", opts.Identity, opts.Merge)
+	fmt.Printf("资产:       Web资产 %d 个，非web服务 %d 个，待验证域名 %d 个，观测 %d 条，单位 %d 个\n",
+		summary.WebAssets, summary.Services, summary.Domains, summary.Observations, summary.Units)
+
+	sources, err := observationsBySource(store, tableName)
+	if err != nil {
+		log.Printf("[!] 统计观测来源失败: %v", err)
+	} else if len(sources) > 0 {
+		fmt.Printf("观测来源:   %s\n", sources)
+	}
+
+	if rec == nil {
+		fmt.Println("[*] 该任务由旧版本生成，没有任务元数据")
+		return 0
+	}
+	fmt.Printf("执行人:     %s\n", orDash(rec.Owner))
+	if rec.TargetFile != "" {
+		fmt.Printf("目标文件:   %s（%d 条记录，SHA-256 %s）\n", rec.TargetFile, rec.TargetRows, rec.TargetSHA256)
+	}
+	if len(rec.Providers) > 0 {
+		fmt.Printf("启用平台:   %s\n", strings.Join(rec.Providers, ", "))
+	}
+	if len(rec.ProviderCounts) > 0 {
+		fmt.Printf("平台结果数: %s\n", formatCounts(rec.ProviderCounts))
+	}
+	if len(rec.Credits) > 0 {
+		fmt.Printf("积分消耗:   %s\n", formatCounts(rec.Credits))
+	}
+	if len(rec.MergedFrom) > 0 {
+		fmt.Printf("合并来源:   %s\n", strings.Join(rec.MergedFrom, ", "))
+	}
+	if rec.ImportedFrom != "" {
+		fmt.Printf("导入自:     %s\n", rec.ImportedFrom)
+	}
+	if rec.ResultsDir != "" {
+		fmt.Printf("结果目录:   %s\n", rec.ResultsDir)
+	}
+	if len(rec.Errors) > 0 {
+		fmt.Printf("错误:       %d 条\n", len(rec.Errors))
+		for i, e := range rec.Errors {
+			if i == 10 {
+				fmt.Printf("  ……其余 %d 条见 manifest.json\n", len(rec.Errors)-i)
+				break
+			}
+			fmt.Printf("  [%s] %s %s %s: %s\n", e.Time, e.Stage, e.Provider, e.Target, e.Message)
+		}
+	}
+	return 0
+}
+
+// observationsBySource 按来源平台统计任务的观测数，格式如 fofa=10, quake=3
+func observationsBySource(store database.Storage, tableName string) (string, error) {
+	rows, err := store.Query(fmt.Sprintf("SELECT COALESCE(source, ''), COUNT(*) FROM %s GROUP BY source ORDER BY source", database.ObservationTableName(tableName)))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var source string
+		var n int
+		if err := rows.Scan(&source, &n); err != nil {
+			return "", err
+		}
+		counts[source] = n
+	}
+	return formatCounts(counts), rows.Err()
+}
+
+// runDelete 删除任务：可逐个指定，或以 -before 删除指定日期之前创建的全部任务
+func runDelete(args []string) int {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	before := fs.String("before", "", "删除该日期（YYYYMMDD）之前创建的全部任务")
+	yes := fs.Bool("y", false, "不再确认，直接删除")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan delete [-y] [-before YYYYMMDD] [任务...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() == 0 && *before == "" {
+		fs.Usage()
+		return 1
+	}
+	if *before != "" {
+		if _, err := time.Parse("20060102", *before); err != nil {
+			log.Printf("[!] 日期格式应为 YYYYMMDD: %s", *before)
+			return 1
+		}
+	}
+
+	store, err := openCommandStorage()
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	var tables []string
+	seen := make(map[string]bool)
+	for _, arg := range fs.Args() {
+		tableName, err := resolveTask(store, arg)
+		if err != nil {
+			log.Printf("[!] %v", err)
+			return 1
+		}
+		if !seen[tableName] {
+			seen[tableName] = true
+			tables = append(tables, tableName)
+		}
+	}
+	if *before != "" {
+		names, err := store.ListTasks()
+		if err != nil {
+			log.Printf("[!] 列出任务失败: %v", err)
+			return 1
+		}
+		for _, t := range names {
+			// 任务ID以创建日期开头
+			if t.TaskID < *before && !seen[t.TableName] {
+				seen[t.TableName] = true
+				tables = append(tables, t.TableName)
+			}
+		}
+	}
+	if len(tables) == 0 {
+		fmt.Println("[*] 没有需要删除的任务")
+		return 0
+	}
+
+	fmt.Printf("[*] 将删除以下 %d 个任务（跨任务清单中的发现记录保留）:\n", len(tables))
+	for _, t := range tables {
+		fmt.Println("    " + t)
+	}
+	if !*yes && !confirm("确认删除？[y/N] ") {
+		fmt.Println("[*] 已取消")
+		return 0
+	}
+
+	failed := 0
+	for _, t := range tables {
+		if err := store.DeleteTask(t); err != nil {
+			log.Printf("[!] 删除任务 %s 失败: %v", t, err)
+			failed++
+			continue
+		}
+		fmt.Println("[*] 已删除任务:", t)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runRename 设置任务的项目名称，名称为空字符串时清除
+func runRename(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan rename <任务> <项目名称>")
+		return 1
+	}
+
+	store, err := openCommandStorage()
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	tableName, err := resolveTask(store, args[0])
+	if err != nil {
+		log.Printf("[!] %v", err)
+		return 1
+	}
+	name := strings.TrimSpace(args[1])
+	if err := store.RenameTask(tableName, name); err != nil {
+		log.Printf("[!] 设置项目名称失败: %v", err)
+		return 1
+	}
+	fmt.Printf("[*] 任务 %s 的项目名称已设为: %s\n", tableName, orDash(name))
+	return 0
+}
+
+// runMerge 将多个任务合并为一个新任务：按任务顺序依次写入，去重合并规则与测绘时入库一致
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	name := fs.String("name", "", "新任务的项目名称")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: cyberscan merge [-name 项目名称] <任务A> <任务B> [任务...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return 1
+	}
+
+	store, err := openCommandStorage()
+	if err != nil {
+		log.Printf("[!] 打开数据库失败: %v", err)
+		return 1
+	}
+	defer store.Close()
+
+	var sources []string
+	for _, arg := range fs.Args() {
+		tableName, err := resolveTask(store, arg)
+		if err != nil {
+			log.Printf("[!] %v", err)
+			return 1
+		}
+		sources = append(sources, tableName)
+	}
+
+	// 新任务沿用第一个任务的去重规则
+	opts, err := database.LoadTaskOptions(store, sources[0])
+	if err != nil {
+		log.Printf("[!] 读取任务选项失败: %v", err)
+		return 1
+	}
+	for _, source := range sources[1:] {
+		other, err := database.LoadTaskOptions(store, source)
+		if err != nil {
+			log.Printf("[!] 读取任务选项失败: %v", err)
+			return 1
+		}
+		if other.Identity != opts.Identity {
+			log.Printf("[!] 任务 %s 的去重身份为 %s，合并后按 %s 去重", source, other.Identity, opts.Identity)
+		}
+	}
+
+	taskID, tableName, err := claimTask(store)
+	if err != nil {
+		log.Printf("[!] 分配任务ID失败: %v", err)
+		return 1
+	}
+	defer store.UnlockTask(tableName)
+
+	rec := database.TaskRecord{
+		TaskID:     taskID,
+		TableName:  tableName,
+		Name:       *name,
+		Status:     database.TaskStatusRunning,
+		Owner:      currentOwner(),
+		StartedAt:  time.Now().Format("2006-01-02 15:04:05"),
+		MergedFrom: sources,
+	}
+	if err := store.InitTask(tableName, opts); err != nil {
+		log.Printf("[!] 创建任务表失败: %v", err)
+		return 1
+	}
+	if err := store.SaveTaskRecord(rec); err != nil {
+		log.Printf("[!] 保存任务元数据失败: %v", err)
+	}
+
+	saved, mergeErr := store.MergeTasks(tableName, sources)
+	rec.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+	rec.Status = database.TaskStatusCompleted
+	if mergeErr != nil {
+		rec.Status = database.TaskStatusFailed
+		rec.Errors = append(rec.Errors, database.TaskError{Time: rec.FinishedAt, Stage: "merge", Message: mergeErr.Error()})
+	}
+	if err := store.SaveTaskRecord(rec); err != nil {
+		log.Printf("[!] 保存任务元数据失败: %v", err)
+	}
+	if mergeErr != nil {
+		log.Printf("[!] 合并任务失败: %v", mergeErr)
+		return 1
+	}
+
+	summary, err := database.GetTaskSummary(store, tableName)
+	if err != nil {
+		log.Printf("[!] 统计任务失败: %v", err)
+		return 1
+	}
+	fmt.Printf("[+] 已合并 %d 个任务，写入 %d 条结果\n", len(sources), saved)
+	fmt.Printf("[+] 新任务ID: %s（Web资产 %d 个，非web服务 %d 个）\n", taskID, summary.WebAssets, summary.Services)
+	return 0
+}
+
+// confirm 在终端询问是否继续
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+// formatCounts 按名称排序格式化计数，如 fofa=10, quake=3
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		name := k
+		if name == "" {
+			name = "(未知)"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d", name, counts[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// orDash 空值显示为 -
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
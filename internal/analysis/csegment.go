@@ -3,115 +3,227 @@ package analysis
 import (
 	"cyberspace_mapping_summary/internal/database"
 	"cyberspace_mapping_summary/internal/model"
-	"database/sql"
+	"cyberspace_mapping_summary/internal/ranges"
 	"fmt"
 	"log"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-// CSegmentInfo 表示C段信息
+// CSegmentInfo 表示高密度网段信息（默认为C段，掩码长度可配置）
 type CSegmentInfo struct {
 	CIDR          string
 	Organizations []string
 	IsMixed       bool
+	Provider      string // 网段与CDN/云厂商共享时为厂商标记（如 cdn:cloudflare），否则为空
 }
 
-// CSegmentAnalysis 执行C段分析
-func CSegmentAnalysis(db *sql.DB, tableName string, threshold int) ([]CSegmentInfo, error) {
-	log.Printf("[*] 开始C段分析，阈值: %d", threshold)
+// 与CDN/云厂商共享的网段在第二轮的处理方式
+const (
+	SharedCIDRExclude  = "exclude"  // 不做二次扫描（默认）
+	SharedCIDRSeparate = "separate" // 照常扫描，新发现的IP单独导出
+	SharedCIDRInclude  = "include"  // 与普通网段相同
+)
+
+// CSegmentAnalysis 执行C段分析，网段的掩码长度与聚合方式由 opts 指定；
+// 网段整段落在 ipRanges 的某个网段内，或其中过半IP已标记为同一CDN/云厂商时，记为共享网段
+func CSegmentAnalysis(store database.Storage, tableName string, threshold int, opts database.CIDROptions, ipRanges *ranges.Set) ([]CSegmentInfo, error) {
+	log.Printf("[*] 开始C段分析，阈值: %d，%s", threshold, describeCIDROptions(opts))
 
-	// 获取高密度C段
-	cidrs, err := database.GetHighDensityCIDRs(db, tableName, threshold)
+	// 获取高密度网段
+	cidrs, err := store.GetHighDensityCIDRs(tableName, threshold, opts)
 	if err != nil {
 		return nil, fmt.Errorf("获取高密度C段失败: %v", err)
 	}
 
 	var cSegmentInfos []CSegmentInfo
-	log.Printf("[*] 发现 %d 个高密度C段", len(cidrs))
+	log.Printf("[*] 发现 %d 个高密度网段", len(cidrs))
 
 	for i, cidr := range cidrs {
-		// 分析C段的组织归属
-		organizations, err := getOrganizationsInCIDR(db, tableName, cidr)
+		// 分析网段的组织归属
+		organizations, err := getOrganizationsInCIDR(store, tableName, cidr)
 		if err != nil {
-			log.Printf("[!] 分析C段 %s 组织归属失败: %v", cidr, err)
+			log.Printf("[!] 分析网段 %s 组织归属失败: %v", cidr, err)
 			continue
 		}
 
-		// 判断是否为混合C段（包含多个组织）
+		// 判断是否为混合网段（包含多个组织）
 		isMixed := len(organizations) > 1
 
+		// 判断是否为CDN/云厂商共享网段：先看网段库中是否有整段包含它的网段，再按网段内过半IP的厂商标记
+		provider := ipRanges.MatchCIDR(cidr)
+		if provider == "" {
+			provider, err = getProviderInCIDR(store, tableName, cidr)
+			if err != nil {
+				log.Printf("[!] 分析网段 %s 所属厂商失败: %v", cidr, err)
+			}
+		}
+
 		cSegmentInfo := CSegmentInfo{
 			CIDR:          cidr,
 			Organizations: organizations,
 			IsMixed:       isMixed,
+			Provider:      provider,
 		}
 
 		cSegmentInfos = append(cSegmentInfos, cSegmentInfo)
 
-		log.Printf("[%d] %s (组织: %s, 混合: %t)",
-			i+1, cidr, strings.Join(organizations, ";"), isMixed)
+		if provider != "" {
+			log.Printf("[%d] %s (组织: %s, 混合: %t, 共享: %s)",
+				i+1, cidr, strings.Join(organizations, ";"), isMixed, provider)
+		} else {
+			log.Printf("[%d] %s (组织: %s, 混合: %t)",
+				i+1, cidr, strings.Join(organizations, ";"), isMixed)
+		}
 	}
 
 	return cSegmentInfos, nil
 }
 
-// getOrganizationsInCIDR 获取指定C段中的组织列表
-func getOrganizationsInCIDR(db *sql.DB, tableName, cidr string) ([]string, error) {
-	// 提取C段前缀
-	ipParts := strings.Split(cidr, "/")
-	if len(ipParts) != 2 {
-		return nil, fmt.Errorf("无效的CIDR格式: %s", cidr)
+// describeCIDROptions 日志中显示的网段聚合方式
+func describeCIDROptions(opts database.CIDROptions) string {
+	opts = opts.WithDefaults()
+	if opts.Mode == database.CIDRModeAdaptive {
+		return fmt.Sprintf("自适应网段: IPv4 /%d–/%d，IPv6 /%d–/%d", opts.MinPrefix, opts.MaxPrefix, opts.MinPrefixV6, opts.MaxPrefixV6)
 	}
+	return fmt.Sprintf("网段: IPv4 /%d，IPv6 /%d", opts.Prefix, opts.PrefixV6)
+}
 
-	baseIP := ipParts[0]
-	prefix := strings.TrimSuffix(baseIP, ".0") + "."
+// getOrganizationsInCIDR 获取指定网段中的组织列表
+func getOrganizationsInCIDR(db database.Querier, tableName, cidr string) ([]string, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的CIDR格式: %s", cidr)
+	}
 
-	// 查询该C段中所有IP对应的组织
-	query := fmt.Sprintf("SELECT DISTINCT org_code FROM %s WHERE ip LIKE ? AND org_code IS NOT NULL AND org_code != ''", tableName)
-	rows, err := db.Query(query, prefix+"%")
+	// 按网段共同的前缀八位组粗筛，是否落在网段内在下面精确判断
+	query := fmt.Sprintf("SELECT DISTINCT ip, org_code FROM %s AS a WHERE ip LIKE ? AND org_code IS NOT NULL AND org_code != ''", database.AssetIPSubquery(tableName))
+	rows, err := db.Query(query, cidrLikePattern(ipnet))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	seen := make(map[string]bool)
 	var organizations []string
 	for rows.Next() {
-		var org string
-		if err := rows.Scan(&org); err != nil {
+		var ip, org string
+		if err := rows.Scan(&ip, &org); err != nil {
 			continue
 		}
-		organizations = append(organizations, org)
+		if parsed := net.ParseIP(ip); parsed == nil || !ipnet.Contains(parsed) {
+			continue
+		}
+		if !seen[org] {
+			seen[org] = true
+			organizations = append(organizations, org)
+		}
 	}
+	sort.Strings(organizations)
 
-	return organizations, nil
+	return organizations, rows.Err()
 }
 
-// GenerateSecondRoundTargets 根据C段生成第二轮查询目标，过滤掉第一轮已查询的C段
-func GenerateSecondRoundTargets(cSegmentInfos []CSegmentInfo, firstRoundTargets []model.TargetEntry) []model.TargetEntry {
+// getProviderInCIDR 返回网段内过半IP共同的CDN/云厂商标记；已标记的IP不足半数时为空，
+// 单位自有网段里混有个别云主机或CDN节点时不会因此整段视为共享网段
+func getProviderInCIDR(db database.Querier, tableName, cidr string) (string, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("无效的CIDR格式: %s", cidr)
+	}
+
+	query := fmt.Sprintf("SELECT DISTINCT ip, COALESCE(ip_provider, '') FROM %s WHERE ip LIKE ?", database.AssetTableName(tableName))
+	rows, err := db.Query(query, cidrLikePattern(ipnet))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	// 同一IP的多条资产只计一次
+	ips := make(map[string]bool)
+	providerIPs := make(map[string]map[string]bool)
+	for rows.Next() {
+		var ip, provider string
+		if err := rows.Scan(&ip, &provider); err != nil {
+			continue
+		}
+		if parsed := net.ParseIP(ip); parsed == nil || !ipnet.Contains(parsed) {
+			continue
+		}
+		ips[ip] = true
+		if provider == "" {
+			continue
+		}
+		if providerIPs[provider] == nil {
+			providerIPs[provider] = make(map[string]bool)
+		}
+		providerIPs[provider][ip] = true
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	var best string
+	for provider, set := range providerIPs {
+		n := len(set)
+		if n > len(providerIPs[best]) || (n == len(providerIPs[best]) && provider < best) {
+			best = provider
+		}
+	}
+	if best == "" || len(providerIPs[best])*2 <= len(ips) {
+		return "", nil
+	}
+	return best, nil
+}
+
+// cidrLikePattern 返回网段内IP共有的完整八位组组成的 LIKE 模式，如 10.1.2.0/25 为 "10.1.2.%"；
+// IPv6 的压缩写法没有固定的文本前缀，只筛出 IPv6 地址
+func cidrLikePattern(ipnet *net.IPNet) string {
+	ones, _ := ipnet.Mask.Size()
+	ip4 := ipnet.IP.To4()
+	if ip4 == nil {
+		return "%:%"
+	}
+	var parts []string
+	for i := 0; i < ones/8 && i < 3; i++ {
+		parts = append(parts, strconv.Itoa(int(ip4[i])))
+	}
+	if len(parts) == 0 {
+		return "%"
+	}
+	return strings.Join(parts, ".") + ".%"
+}
+
+// GenerateSecondRoundTargets 根据C段生成第二轮查询目标，过滤掉第一轮已查询的C段；
+// sharedMode 为 exclude 时同时过滤掉与CDN/云厂商共享的网段
+func GenerateSecondRoundTargets(cSegmentInfos []CSegmentInfo, firstRoundTargets []model.TargetEntry, sharedMode string) []model.TargetEntry {
 	var targets []model.TargetEntry
 
-	// 创建第一轮查询目标的C段映射，用于快速查找
-	firstRoundCIDRs := make(map[string]bool)
+	// 第一轮查询目标中的网段，用于判断二轮网段是否已被覆盖
+	var firstRoundCIDRs []*net.IPNet
 	for _, target := range firstRoundTargets {
-		// 检查目标是否为C段格式
-		if isCIDRFormat(target.Host) {
-			firstRoundCIDRs[target.Host] = true
+		if _, ipnet, err := net.ParseCIDR(strings.TrimSpace(target.Host)); err == nil {
+			firstRoundCIDRs = append(firstRoundCIDRs, ipnet)
 		}
 	}
 
 	for _, cSegmentInfo := range cSegmentInfos {
-		// 检查该C段是否已在第一轮中查询过
-		if firstRoundCIDRs[cSegmentInfo.CIDR] {
-			fmt.Printf("[*] 跳过已在第一轮查询的C段: %s\n", cSegmentInfo.CIDR)
+		// 检查该网段是否已包含在第一轮查询的网段中
+		if cidrCovered(cSegmentInfo.CIDR, firstRoundCIDRs) {
+			fmt.Printf("[*] 跳过已在第一轮查询的网段: %s\n", cSegmentInfo.CIDR)
+			continue
+		}
+		if cSegmentInfo.Provider != "" && (sharedMode == "" || sharedMode == SharedCIDRExclude) {
+			fmt.Printf("[*] 跳过CDN/云共享网段: %s (%s)\n", cSegmentInfo.CIDR, cSegmentInfo.Provider)
 			continue
 		}
 
-		// 根据组织归属设置单位名称
+		// 根据组织归属设置单位名称：多个单位共享的C段归属全部单位（分号分隔），结果会记入每个单位
 		var unitName string
-		if cSegmentInfo.IsMixed {
-			unitName = "混合C段"
-		} else if len(cSegmentInfo.Organizations) == 1 {
-			unitName = cSegmentInfo.Organizations[0]
+		if len(cSegmentInfo.Organizations) > 0 {
+			unitName = strings.Join(cSegmentInfo.Organizations, ";")
 		} else {
 			unitName = "未知组织"
 		}
@@ -125,43 +237,31 @@ func GenerateSecondRoundTargets(cSegmentInfos []CSegmentInfo, firstRoundTargets
 	return targets
 }
 
-// isCIDRFormat 检查字符串是否为CIDR格式
-func isCIDRFormat(s string) bool {
-	// 简单的CIDR格式检查：包含"/"且以数字结尾
-	parts := strings.Split(s, "/")
-	if len(parts) != 2 {
-		return false
-	}
-
-	// 检查前缀是否为有效IP
-	ip := parts[0]
-	ipParts := strings.Split(ip, ".")
-	if len(ipParts) != 4 {
+// cidrCovered 判断网段是否包含在任一给定网段中
+func cidrCovered(cidr string, nets []*net.IPNet) bool {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
 		return false
 	}
-
-	// 检查后缀是否为有效数字
-	if parts[1] == "24" || parts[1] == "16" || parts[1] == "8" {
-		return true
+	ones, bits := ipnet.Mask.Size()
+	for _, n := range nets {
+		nOnes, nBits := n.Mask.Size()
+		if nBits == bits && nOnes <= ones && n.Contains(ipnet.IP) {
+			return true
+		}
 	}
-
 	return false
 }
 
-// GetExistingIPsInCIDR 获取指定C段中已存在的IP
-func GetExistingIPsInCIDR(db *sql.DB, tableName, cidr string) ([]string, error) {
-	query := fmt.Sprintf("SELECT DISTINCT ip FROM %s WHERE ip LIKE ?", tableName)
-
-	// 提取C段前缀
-	ipParts := strings.Split(cidr, "/")
-	if len(ipParts) != 2 {
+// GetExistingIPsInCIDR 获取指定网段中已存在的IP
+func GetExistingIPsInCIDR(db database.Querier, tableName, cidr string) ([]string, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
 		return nil, fmt.Errorf("无效的CIDR格式: %s", cidr)
 	}
 
-	baseIP := ipParts[0]
-	prefix := strings.TrimSuffix(baseIP, ".0") + "."
-
-	rows, err := db.Query(query, prefix+"%")
+	query := fmt.Sprintf("SELECT DISTINCT ip FROM %s AS a WHERE ip LIKE ?", database.AssetIPSubquery(tableName))
+	rows, err := db.Query(query, cidrLikePattern(ipnet))
 	if err != nil {
 		return nil, err
 	}
@@ -173,8 +273,10 @@ func GetExistingIPsInCIDR(db *sql.DB, tableName, cidr string) ([]string, error)
 		if err := rows.Scan(&ip); err != nil {
 			continue
 		}
-		ips = append(ips, ip)
+		if parsed := net.ParseIP(ip); parsed != nil && ipnet.Contains(parsed) {
+			ips = append(ips, ip)
+		}
 	}
 
-	return ips, nil
+	return ips, rows.Err()
 }
@@ -0,0 +1,87 @@
+package analysis
+
+import (
+	"cyberspace_mapping_summary/internal/database"
+	"cyberspace_mapping_summary/internal/model"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// openTestStore 在临时目录中创建 res.db 并按默认选项创建任务
+func openTestStore(t *testing.T, tables ...string) database.Storage {
+	t.Helper()
+	store, err := database.Open(database.DriverSQLite, filepath.Join(t.TempDir(), "res.db"))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, table := range tables {
+		if err := store.InitTask(table, database.DefaultTaskOptions()); err != nil {
+			t.Fatalf("创建任务失败: %v", err)
+		}
+	}
+	return store
+}
+
+func TestGetProviderInCIDR(t *testing.T) {
+	// service 生成 10.0.0.<n>:22 的服务，provider 为其厂商标记
+	service := func(n int, provider string) model.QueryResult {
+		ip := fmt.Sprintf("10.0.0.%d", n)
+		return model.QueryResult{Unit: "A", Source: "fofa", Host: ip, Protocol: "ssh", IP: ip, Port: 22, IPProvider: provider}
+	}
+
+	tests := []struct {
+		name    string
+		results []model.QueryResult
+		cidr    string
+		want    string
+	}{
+		{
+			name:    "过半IP为同一厂商",
+			results: []model.QueryResult{service(1, "cloud:aliyun"), service(2, "cloud:aliyun"), service(3, "")},
+			cidr:    "10.0.0.0/24",
+			want:    "cloud:aliyun",
+		},
+		{
+			name:    "单位网段中只有个别云主机",
+			results: []model.QueryResult{service(1, "cloud:aliyun"), service(2, ""), service(3, ""), service(4, "")},
+			cidr:    "10.0.0.0/24",
+			want:    "",
+		},
+		{
+			name:    "恰好半数不算共享",
+			results: []model.QueryResult{service(1, "cdn:cloudflare"), service(2, "cdn:cloudflare"), service(3, ""), service(4, "")},
+			cidr:    "10.0.0.0/24",
+			want:    "",
+		},
+		{
+			name:    "多个厂商各不过半",
+			results: []model.QueryResult{service(1, "cloud:aliyun"), service(2, "cloud:tencentcloud"), service(3, "cdn:cloudflare")},
+			cidr:    "10.0.0.0/24",
+			want:    "",
+		},
+		{
+			name:    "只统计网段内的IP",
+			results: []model.QueryResult{service(1, "cloud:aliyun"), service(2, ""), service(200, "cloud:aliyun"), service(201, "cloud:aliyun")},
+			cidr:    "10.0.0.0/25",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := openTestStore(t, "task_1")
+			if err := store.SaveResults("task_1", tt.results); err != nil {
+				t.Fatal(err)
+			}
+			got, err := getProviderInCIDR(store, "task_1", tt.cidr)
+			if err != nil {
+				t.Fatalf("getProviderInCIDR: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getProviderInCIDR(%s) = %q, want %q", tt.cidr, got, tt.want)
+			}
+		})
+	}
+}
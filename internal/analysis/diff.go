@@ -0,0 +1,301 @@
+package analysis
+
+import (
+	"cyberspace_mapping_summary/internal/database"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 资产变化类型
+const (
+	ChangeNew         = "new"         // 仅在新任务中出现
+	ChangeDisappeared = "disappeared" // 仅在旧任务中出现
+	ChangeChanged     = "changed"     // 两次任务都出现，但关键字段发生变化
+)
+
+// diffAsset 参与对比的资产快照
+type diffAsset struct {
+	Key        string
+	Kind       string
+	OrgCode    string
+	URL        string
+	IP         string
+	Port       int
+	Title      string
+	StatusCode int
+}
+
+// FieldChange 单个字段的变化
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// AssetChange 单个资产的变化记录
+type AssetChange struct {
+	Type    string
+	Kind    string
+	Key     string
+	OrgCode string
+	URL     string
+	IP      string
+	Port    int
+	Fields  []FieldChange // 仅changed类型有值
+}
+
+// TaskDiff 两个任务之间的差异
+type TaskDiff struct {
+	OldTable       string
+	NewTable       string
+	Changes        []AssetChange
+	NewIPs         []string // 新任务中首次出现的IP
+	DisappearedIPs []string // 新任务中不再出现的IP
+}
+
+// Count 统计指定类型的变化数量
+func (d *TaskDiff) Count(changeType string) int {
+	n := 0
+	for _, c := range d.Changes {
+		if c.Type == changeType {
+			n++
+		}
+	}
+	return n
+}
+
+// loadDiffAssets 读取任务的全部资产（web资产、非web服务与待验证域名）
+// 资产按清单资产键对齐，与任务的去重规则无关：按 host / ip_port 去重的任务中合并在一起的多个URL各为一条，
+// 同一个键对应多个资产时取编号最小的资产
+func loadDiffAssets(db database.Querier, tableName string) (map[string]diffAsset, error) {
+	query := fmt.Sprintf(`SELECT a.kind, COALESCE(a.asset_key, ''), COALESCE(NULLIF(a.org_code, ''), u.name, ''),
+    COALESCE(NULLIF(o.url, ''), a.url, ''), COALESCE(NULLIF(o.ip, ''), a.ip, ''), COALESCE(NULLIF(o.port, 0), a.port, 0),
+    COALESCE(a.title, ''), COALESCE(a.status_code, 0)
+FROM %s a LEFT JOIN %s u ON u.id = a.unit_id LEFT JOIN %s o ON o.asset_id = a.id
+ORDER BY a.id`, database.AssetTableName(tableName), database.UnitTableName(tableName), database.ObservationTableName(tableName))
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := make(map[string]diffAsset)
+	for rows.Next() {
+		var a diffAsset
+		if err := rows.Scan(&a.Kind, &a.Key, &a.OrgCode, &a.URL, &a.IP, &a.Port, &a.Title, &a.StatusCode); err != nil {
+			return nil, err
+		}
+		// 待验证域名的资产键本身就是域名
+		if a.Kind != database.AssetKindDomain {
+			a.Key = database.InventoryKey(a.Kind, a.URL, a.IP, a.Port)
+		}
+		if _, ok := assets[a.Key]; ok {
+			continue
+		}
+		a.URL = strings.TrimSpace(strings.Split(a.URL, ";")[0])
+		// 单位与标题按发现顺序合并，各平台并发返回时顺序不固定，按集合比较
+		a.OrgCode = sortedList(a.OrgCode)
+		a.Title = sortedList(a.Title)
+		assets[a.Key] = a
+	}
+	return assets, rows.Err()
+}
+
+// sortedList 将分号分隔的列表去重、排序后重新拼接
+func sortedList(value string) string {
+	seen := make(map[string]bool)
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ";")
+}
+
+// DiffTasks 对比两个任务：新增资产、消失资产，以及标题、状态码、端口、单位发生变化的资产
+func DiffTasks(db database.Querier, oldTable, newTable string) (*TaskDiff, error) {
+	oldAssets, err := loadDiffAssets(db, oldTable)
+	if err != nil {
+		return nil, fmt.Errorf("读取任务 %s 失败: %v", oldTable, err)
+	}
+	newAssets, err := loadDiffAssets(db, newTable)
+	if err != nil {
+		return nil, fmt.Errorf("读取任务 %s 失败: %v", newTable, err)
+	}
+
+	diff := &TaskDiff{OldTable: oldTable, NewTable: newTable}
+	oldIPs := make(map[string]bool)
+	newIPs := make(map[string]bool)
+
+	for key, n := range newAssets {
+		if n.IP != "" {
+			newIPs[n.IP] = true
+		}
+		o, ok := oldAssets[key]
+		if !ok {
+			diff.Changes = append(diff.Changes, newAssetChange(ChangeNew, n))
+			continue
+		}
+
+		var fields []FieldChange
+		if o.Title != n.Title {
+			fields = append(fields, FieldChange{Field: "title", Old: o.Title, New: n.Title})
+		}
+		if o.StatusCode != n.StatusCode {
+			fields = append(fields, FieldChange{Field: "status_code", Old: fmt.Sprintf("%d", o.StatusCode), New: fmt.Sprintf("%d", n.StatusCode)})
+		}
+		if o.Port != n.Port {
+			fields = append(fields, FieldChange{Field: "port", Old: fmt.Sprintf("%d", o.Port), New: fmt.Sprintf("%d", n.Port)})
+		}
+		if o.OrgCode != n.OrgCode {
+			fields = append(fields, FieldChange{Field: "org_code", Old: o.OrgCode, New: n.OrgCode})
+		}
+		if len(fields) > 0 {
+			change := newAssetChange(ChangeChanged, n)
+			change.Fields = fields
+			diff.Changes = append(diff.Changes, change)
+		}
+	}
+
+	for key, o := range oldAssets {
+		if o.IP != "" {
+			oldIPs[o.IP] = true
+		}
+		if _, ok := newAssets[key]; !ok {
+			diff.Changes = append(diff.Changes, newAssetChange(ChangeDisappeared, o))
+		}
+	}
+
+	for ip := range newIPs {
+		if !oldIPs[ip] {
+			diff.NewIPs = append(diff.NewIPs, ip)
+		}
+	}
+	for ip := range oldIPs {
+		if !newIPs[ip] {
+			diff.DisappearedIPs = append(diff.DisappearedIPs, ip)
+		}
+	}
+
+	// 固定输出顺序：变化类型 -> 单位 -> 资产键
+	typeOrder := map[string]int{ChangeNew: 0, ChangeDisappeared: 1, ChangeChanged: 2}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		a, b := diff.Changes[i], diff.Changes[j]
+		if a.Type != b.Type {
+			return typeOrder[a.Type] < typeOrder[b.Type]
+		}
+		if a.OrgCode != b.OrgCode {
+			return a.OrgCode < b.OrgCode
+		}
+		return a.Key < b.Key
+	})
+	sort.Strings(diff.NewIPs)
+	sort.Strings(diff.DisappearedIPs)
+
+	return diff, nil
+}
+
+// newAssetChange 根据资产快照构造变化记录
+func newAssetChange(changeType string, a diffAsset) AssetChange {
+	return AssetChange{
+		Type:    changeType,
+		Kind:    a.Kind,
+		Key:     a.Key,
+		OrgCode: a.OrgCode,
+		URL:     a.URL,
+		IP:      a.IP,
+		Port:    a.Port,
+	}
+}
+
+// ExportTaskDiff 导出差异明细CSV：changed类型每个变化字段一行
+func ExportTaskDiff(diff *TaskDiff, outputPath string) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 写入UTF-8 BOM
+	file.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	header := []string{"ChangeType", "Kind", "OrgCode", "AssetKey", "URL", "IP", "Port", "Field", "Old", "New"}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("写入CSV头部失败: %v", err)
+	}
+
+	for _, c := range diff.Changes {
+		base := []string{c.Type, c.Kind, c.OrgCode, c.Key, c.URL, c.IP, fmt.Sprintf("%d", c.Port)}
+		if len(c.Fields) == 0 {
+			if err := writer.Write(append(base, "", "", "")); err != nil {
+				return fmt.Errorf("写入CSV数据行失败: %v", err)
+			}
+			continue
+		}
+		for _, f := range c.Fields {
+			row := append(append([]string{}, base...), f.Field, f.Old, f.New)
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("写入CSV数据行失败: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteTaskDiffSummary 生成差异摘要文本
+func WriteTaskDiffSummary(diff *TaskDiff, outputPath string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "任务对比: %s -> %s\n", diff.OldTable, diff.NewTable)
+	fmt.Fprintf(&b, "生成时间: %s\n\n", getCurrentTime())
+	fmt.Fprintf(&b, "新增资产: %d\n", diff.Count(ChangeNew))
+	fmt.Fprintf(&b, "消失资产: %d\n", diff.Count(ChangeDisappeared))
+	fmt.Fprintf(&b, "变化资产: %d\n", diff.Count(ChangeChanged))
+	fmt.Fprintf(&b, "新增IP: %d\n", len(diff.NewIPs))
+	fmt.Fprintf(&b, "消失IP: %d\n", len(diff.DisappearedIPs))
+
+	sections := []struct {
+		title      string
+		changeType string
+	}{
+		{"新增资产", ChangeNew},
+		{"消失资产", ChangeDisappeared},
+		{"变化资产", ChangeChanged},
+	}
+	for _, s := range sections {
+		if diff.Count(s.changeType) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n== %s ==\n", s.title)
+		for _, c := range diff.Changes {
+			if c.Type != s.changeType {
+				continue
+			}
+			fmt.Fprintf(&b, "[%s] %s", c.OrgCode, c.Key)
+			for _, f := range c.Fields {
+				fmt.Fprintf(&b, " | %s: %q -> %q", f.Field, f.Old, f.New)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(diff.NewIPs) > 0 {
+		fmt.Fprintf(&b, "\n== 新增IP ==\n%s\n", strings.Join(diff.NewIPs, "\n"))
+	}
+	if len(diff.DisappearedIPs) > 0 {
+		fmt.Fprintf(&b, "\n== 消失IP ==\n%s\n", strings.Join(diff.DisappearedIPs, "\n"))
+	}
+
+	return os.WriteFile(outputPath, []byte(b.String()), 0644)
+}
@@ -1,7 +1,7 @@
 package analysis
 
 import (
-	"database/sql"
+	"cyberspace_mapping_summary/internal/database"
 	"encoding/csv"
 	"fmt"
 	"log"
@@ -19,20 +19,21 @@ type IPAnalysisResult struct {
 }
 
 // AnalyzeIPBusinessCount 分析IP业务数量
-func AnalyzeIPBusinessCount(db *sql.DB, tableName string, threshold int) ([]IPAnalysisResult, error) {
+func AnalyzeIPBusinessCount(db database.Querier, tableName string, threshold int) ([]IPAnalysisResult, error) {
 	log.Printf("[*] 开始IP业务数量分析，阈值: %d", threshold)
 
 	// 查询每个IP关联的URL数量
+	d := database.DialectOf(db)
 	query := fmt.Sprintf(`
 		SELECT ip, COUNT(DISTINCT url) as url_count, 
-		       GROUP_CONCAT(DISTINCT domain) as domains,
-		       GROUP_CONCAT(DISTINCT source) as sources
+		       %s as domains,
+		       %s as sources
 		FROM %s 
 		WHERE ip IS NOT NULL AND ip != ''
 		GROUP BY ip 
-		HAVING url_count >= ?
+		HAVING COUNT(DISTINCT url) >= ?
 		ORDER BY url_count DESC
-	`, tableName)
+	`, d.GroupConcatDistinct("domain"), d.GroupConcatDistinct("source"), tableName)
 
 	rows, err := db.Query(query, threshold)
 	if err != nil {
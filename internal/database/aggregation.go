@@ -1,49 +1,282 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
-	"net"
+	"net/netip"
 	"sort"
 	"strings"
 )
 
-func GetHighDensityCIDRs(db *sql.DB, tableName string, threshold int) ([]string, error) {
-	query := fmt.Sprintf("SELECT DISTINCT ip FROM %s", tableName)
+// 高密度网段的聚合方式
+const (
+	CIDRModeFixed    = "fixed"    // 按固定掩码长度切分
+	CIDRModeAdaptive = "adaptive" // 为每个IP簇选取能覆盖它的最小网段
+)
+
+// 网段掩码长度的默认值
+const (
+	DefaultCIDRPrefix      = 24
+	DefaultCIDRMinPrefix   = 22
+	DefaultCIDRMaxPrefix   = 28
+	DefaultCIDRPrefixV6    = 64
+	DefaultCIDRMinPrefixV6 = 48
+	DefaultCIDRMaxPrefixV6 = 64
+)
+
+// CIDROptions 高密度网段的聚合方式，IPv4 与 IPv6 地址分别按各自的掩码长度聚合
+type CIDROptions struct {
+	Mode        string // fixed（默认）或 adaptive
+	Prefix      int    // fixed 模式的 IPv4 掩码长度，0 为 24
+	MinPrefix   int    // adaptive 模式最粗的 IPv4 掩码长度，0 为 22
+	MaxPrefix   int    // adaptive 模式最细的 IPv4 掩码长度，0 为 28
+	PrefixV6    int    // fixed 模式的 IPv6 掩码长度，0 为 64
+	MinPrefixV6 int    // adaptive 模式最粗的 IPv6 掩码长度，0 为 48
+	MaxPrefixV6 int    // adaptive 模式最细的 IPv6 掩码长度，0 为 64
+}
+
+// WithDefaults 补齐未配置的聚合方式与掩码长度
+func (o CIDROptions) WithDefaults() CIDROptions {
+	if o.Mode == "" {
+		o.Mode = CIDRModeFixed
+	}
+	if o.Prefix == 0 {
+		o.Prefix = DefaultCIDRPrefix
+	}
+	if o.MinPrefix == 0 {
+		o.MinPrefix = DefaultCIDRMinPrefix
+	}
+	if o.MaxPrefix == 0 {
+		o.MaxPrefix = DefaultCIDRMaxPrefix
+	}
+	if o.PrefixV6 == 0 {
+		o.PrefixV6 = DefaultCIDRPrefixV6
+	}
+	if o.MinPrefixV6 == 0 {
+		o.MinPrefixV6 = DefaultCIDRMinPrefixV6
+	}
+	if o.MaxPrefixV6 == 0 {
+		o.MaxPrefixV6 = DefaultCIDRMaxPrefixV6
+	}
+	return o
+}
+
+// CIDRRollup 分层汇总中的一个网段
+type CIDRRollup struct {
+	Prefix int      // 掩码长度
+	CIDR   string   // 网段
+	Parent string   // 上一层级中包含该网段的网段，最粗一层为空
+	IPs    int      // 网段内的IP数
+	Units  []string // 网段内IP归属的单位
+}
+
+// GetHighDensityCIDRs 统计任务中IP数不少于 threshold 的网段，IPv4 在前、IPv6 在后，各自按地址排序
+// fixed 模式按固定掩码切分；adaptive 模式先按最粗的掩码切分出高密度网段，
+// 再逐级二分：仍满足阈值的一半继续细分（两半都满足时视为两个IP簇分别细分），两半都不满足时当前网段即为覆盖该IP簇的最小网段
+func GetHighDensityCIDRs(db Querier, tableName string, threshold int, opts CIDROptions) ([]string, error) {
+	opts = opts.WithDefaults()
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	ipUnits, err := loadIPUnits(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	ips4, ips6 := splitIPFamilies(sortedIPs(ipUnits))
+
+	var result []string
+	switch opts.Mode {
+	case CIDRModeAdaptive:
+		result = append(result, adaptiveDenseCIDRs(ips4, opts.MinPrefix, opts.MaxPrefix, threshold)...)
+		result = append(result, adaptiveDenseCIDRs(ips6, opts.MinPrefixV6, opts.MaxPrefixV6, threshold)...)
+	case CIDRModeFixed:
+		result = append(result, fixedDenseCIDRs(ips4, opts.Prefix, threshold)...)
+		result = append(result, fixedDenseCIDRs(ips6, opts.PrefixV6, threshold)...)
+	default:
+		return nil, fmt.Errorf("不支持的网段聚合方式: %s", opts.Mode)
+	}
+	return result, nil
+}
+
+// GetCIDRRollup 按 prefixes（IPv4）与 prefixesV6（IPv6）由粗到细逐层汇总任务中的IP地址，
+// 结果按网段地址排序，上层网段排在其包含的下层网段之前
+func GetCIDRRollup(db Querier, tableName string, prefixes, prefixesV6 []int) ([]CIDRRollup, error) {
+	ipUnits, err := loadIPUnits(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	ips4, ips6 := splitIPFamilies(sortedIPs(ipUnits))
+
+	var blocks []netip.Prefix
+	rows := make(map[netip.Prefix]CIDRRollup)
+	for _, family := range []struct {
+		ips    []netip.Addr
+		levels []int
+	}{{ips4, prefixes}, {ips6, prefixesV6}} {
+		levels := append([]int(nil), family.levels...)
+		sort.Ints(levels)
+		for i, bits := range levels {
+			for _, block := range groupIPs(family.ips, bits) {
+				row := CIDRRollup{
+					Prefix: bits,
+					CIDR:   block.prefix.String(),
+					IPs:    len(block.ips),
+					Units:  unitsOf(block.ips, ipUnits),
+				}
+				if i > 0 {
+					row.Parent = netip.PrefixFrom(block.prefix.Addr(), levels[i-1]).Masked().String()
+				}
+				blocks = append(blocks, block.prefix)
+				rows[block.prefix] = row
+			}
+		}
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		if c := blocks[i].Addr().Compare(blocks[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return blocks[i].Bits() < blocks[j].Bits()
+	})
+	result := make([]CIDRRollup, 0, len(blocks))
+	for _, block := range blocks {
+		result = append(result, rows[block])
+	}
+	return result, nil
+}
+
+// loadIPUnits 读取任务中的IP地址及其归属单位
+func loadIPUnits(db Querier, tableName string) (map[netip.Addr][]string, error) {
+	query := fmt.Sprintf("SELECT DISTINCT ip, COALESCE(org_code, '') FROM %s AS a WHERE ip IS NOT NULL AND ip != ''", AssetIPSubquery(tableName))
 	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	cSegmentCount := make(map[string]int)
-
+	ipUnits := make(map[netip.Addr][]string)
 	for rows.Next() {
-		var ip string
-		if err := rows.Scan(&ip); err != nil {
+		var ip, org string
+		if err := rows.Scan(&ip, &org); err != nil {
 			continue
 		}
-		parsed := net.ParseIP(ip)
-		if parsed == nil || parsed.To4() == nil {
-			continue // skip non-IPv4
+		addr, err := netip.ParseAddr(strings.Trim(strings.TrimSpace(ip), "[]"))
+		if err != nil {
+			continue // 跳过无法解析的IP
+		}
+		addr = addr.Unmap().WithZone("")
+		units := ipUnits[addr]
+		for _, name := range strings.Split(org, ";") {
+			if name = strings.TrimSpace(name); name != "" && !containsName(units, name) {
+				units = append(units, name)
+			}
 		}
+		ipUnits[addr] = units
+	}
+	return ipUnits, rows.Err()
+}
 
-		ipParts := strings.Split(ip, ".")
-		if len(ipParts) != 4 {
-			continue
+// ipBlock 按掩码切分出的一个网段及其中的IP（升序）
+type ipBlock struct {
+	prefix netip.Prefix
+	ips    []netip.Addr
+}
+
+// groupIPs 将同一地址族、升序排列的IP按掩码长度切分为网段
+func groupIPs(ips []netip.Addr, bits int) []ipBlock {
+	var blocks []ipBlock
+	for start := 0; start < len(ips); {
+		prefix := netip.PrefixFrom(ips[start], bits).Masked()
+		end := start
+		for end < len(ips) && prefix.Contains(ips[end]) {
+			end++
 		}
+		blocks = append(blocks, ipBlock{prefix: prefix, ips: ips[start:end]})
+		start = end
+	}
+	return blocks
+}
 
-		cidr := fmt.Sprintf("%s.%s.%s.0/24", ipParts[0], ipParts[1], ipParts[2])
-		cSegmentCount[cidr]++
+// fixedDenseCIDRs 按固定掩码切分，返回IP数不少于 threshold 的网段
+func fixedDenseCIDRs(ips []netip.Addr, bits, threshold int) []string {
+	var result []string
+	for _, block := range groupIPs(ips, bits) {
+		if len(block.ips) >= threshold {
+			result = append(result, block.prefix.String())
+		}
 	}
+	return result
+}
 
+// adaptiveDenseCIDRs 先按 minBits 切分出高密度网段，再为其中的IP簇选取能覆盖它的最小网段
+func adaptiveDenseCIDRs(ips []netip.Addr, minBits, maxBits, threshold int) []string {
 	var result []string
-	for cidr, count := range cSegmentCount {
-		if count >= threshold {
-			result = append(result, cidr)
+	for _, block := range groupIPs(ips, minBits) {
+		if len(block.ips) >= threshold {
+			result = append(result, adaptiveCIDRs(block.ips, block.prefix, maxBits, threshold)...)
 		}
 	}
+	return result
+}
 
-	sort.Strings(result)
-	return result, nil
+// adaptiveCIDRs 在 [prefix.Bits(), maxBits] 内为网段中的IP簇选取能覆盖它的最小网段
+// 只在两半都达到阈值（或IP全部落在其中一半）时继续切分，网段中的每个IP都被返回的某个网段覆盖
+func adaptiveCIDRs(ips []netip.Addr, prefix netip.Prefix, maxBits, threshold int) []string {
+	if prefix.Bits() >= maxBits {
+		return []string{prefix.String()}
+	}
+	lower := netip.PrefixFrom(prefix.Addr(), prefix.Bits()+1)
+	i := sort.Search(len(ips), func(i int) bool { return !lower.Contains(ips[i]) })
+
+	switch {
+	case i == len(ips):
+		return adaptiveCIDRs(ips, lower, maxBits, threshold)
+	case i == 0:
+		return adaptiveCIDRs(ips, netip.PrefixFrom(ips[0], prefix.Bits()+1).Masked(), maxBits, threshold)
+	case i >= threshold && len(ips)-i >= threshold:
+		upper := netip.PrefixFrom(ips[i], prefix.Bits()+1).Masked()
+		return append(adaptiveCIDRs(ips[:i], lower, maxBits, threshold), adaptiveCIDRs(ips[i:], upper, maxBits, threshold)...)
+	}
+	// 有一半不足阈值：再切分会漏掉这部分IP，当前网段即为覆盖全部IP的最小网段
+	return []string{prefix.String()}
+}
+
+// sortedIPs 返回升序排列的IP，IPv4 排在 IPv6 之前
+func sortedIPs(ipUnits map[netip.Addr][]string) []netip.Addr {
+	ips := make([]netip.Addr, 0, len(ipUnits))
+	for ip := range ipUnits {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool { return ips[i].Less(ips[j]) })
+	return ips
+}
+
+// splitIPFamilies 将升序排列的IP拆分为 IPv4 与 IPv6 两部分
+func splitIPFamilies(ips []netip.Addr) ([]netip.Addr, []netip.Addr) {
+	i := sort.Search(len(ips), func(i int) bool { return ips[i].Is6() })
+	return ips[:i], ips[i:]
+}
+
+// unitsOf 汇总一组IP的归属单位（排序去重）
+func unitsOf(ips []netip.Addr, ipUnits map[netip.Addr][]string) []string {
+	var units []string
+	for _, ip := range ips {
+		for _, name := range ipUnits[ip] {
+			if !containsName(units, name) {
+				units = append(units, name)
+			}
+		}
+	}
+	sort.Strings(units)
+	return units
+}
+
+// containsName 判断切片中是否包含指定名称
+func containsName(list []string, name string) bool {
+	for _, item := range list {
+		if item == name {
+			return true
+		}
+	}
+	return false
 }
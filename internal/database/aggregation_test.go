@@ -0,0 +1,88 @@
+package database
+
+import (
+	"net/netip"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// parseIPs 解析并升序排列测试用的IP
+func parseIPs(t *testing.T, values ...string) []netip.Addr {
+	t.Helper()
+	ips := make([]netip.Addr, 0, len(values))
+	for _, v := range values {
+		ip, err := netip.ParseAddr(v)
+		if err != nil {
+			t.Fatalf("解析IP %s 失败: %v", v, err)
+		}
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool { return ips[i].Less(ips[j]) })
+	return ips
+}
+
+func TestAdaptiveDenseCIDRs(t *testing.T) {
+	tests := []struct {
+		name      string
+		ips       []string
+		minBits   int
+		maxBits   int
+		threshold int
+		want      []string
+	}{
+		{
+			name: "IP簇收缩到最细掩码",
+			ips:  []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, minBits: 22, maxBits: 28, threshold: 3,
+			want: []string{"10.0.0.0/28"},
+		},
+		{
+			name: "两半都达到阈值时分别细分",
+			ips:  []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.2.1", "10.0.2.2", "10.0.2.3"}, minBits: 22, maxBits: 28, threshold: 3,
+			want: []string{"10.0.0.0/28", "10.0.2.0/28"},
+		},
+		{
+			name: "有一半不足阈值时停在当前网段，不漏掉这部分IP",
+			ips:  []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.3.200"}, minBits: 22, maxBits: 28, threshold: 3,
+			want: []string{"10.0.0.0/22"},
+		},
+		{
+			name: "不足阈值的网段不返回",
+			ips:  []string{"10.0.0.1", "10.0.0.2", "10.1.0.1"}, minBits: 22, maxBits: 28, threshold: 3,
+			want: nil,
+		},
+		{
+			name: "IPv6",
+			ips:  []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"}, minBits: 48, maxBits: 64, threshold: 3,
+			want: []string{"2001:db8::/64"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := adaptiveDenseCIDRs(parseIPs(t, tt.ips...), tt.minBits, tt.maxBits, tt.threshold)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("adaptiveDenseCIDRs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixedDenseCIDRs(t *testing.T) {
+	ips := parseIPs(t, "10.0.0.1", "10.0.0.200", "10.0.1.1", "10.0.2.1", "10.0.2.2", "10.0.2.3")
+	tests := []struct {
+		bits      int
+		threshold int
+		want      []string
+	}{
+		{24, 2, []string{"10.0.0.0/24", "10.0.2.0/24"}},
+		{24, 3, []string{"10.0.2.0/24"}},
+		{23, 3, []string{"10.0.0.0/23", "10.0.2.0/23"}},
+		{25, 2, []string{"10.0.2.0/25"}},
+	}
+	for _, tt := range tests {
+		if got := fixedDenseCIDRs(ips, tt.bits, tt.threshold); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("fixedDenseCIDRs(/%d, %d) = %v, want %v", tt.bits, tt.threshold, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// 资产去重身份
+const (
+	IdentityURL    = "url"     // 按完整规范化URL（含路径）去重
+	IdentityHost   = "host"    // 按 协议+主机+端口 去重，同一站点的不同路径合并为一条
+	IdentityIPPort = "ip_port" // 按 ip:port 去重，同一端口上的不同域名合并为一条（端口扫描交接）
+)
+
+// indexPageRegexp 匹配默认首页文件名，/index.html 与 / 视为同一资源
+var indexPageRegexp = regexp.MustCompile(`(?i)^(index|default)(\.(html?|php|jsp|aspx?|do|action))?$`)
+
+// defaultPorts 各协议的默认端口，规范化时去除
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// CanonicalizeURL 按RFC 3986对URL做规范化，用于去重：
+// 协议与主机名小写、国际化域名转punycode、去除默认端口、路径去除点段与重复斜杠、
+// 默认首页与末尾斜杠归一、丢弃片段与用户信息、查询参数按键排序。
+// identity为IdentityHost时只保留 协议://主机[:端口]。无法解析时退回简单的字符串处理。
+func CanonicalizeURL(raw, identity string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return legacyNormalizeURL(raw)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := canonicalHost(u.Hostname())
+	port := u.Port()
+	if port == defaultPorts[scheme] {
+		port = ""
+	}
+
+	hostPort := host
+	if strings.Contains(host, ":") {
+		hostPort = "[" + host + "]" // IPv6字面量
+	}
+	if port != "" {
+		hostPort += ":" + port
+	}
+
+	base := scheme + "://" + hostPort
+	if identity == IdentityHost {
+		return base
+	}
+
+	result := base + canonicalPath(u.EscapedPath())
+	if u.RawQuery != "" {
+		if query, err := url.ParseQuery(u.RawQuery); err == nil {
+			result += "?" + query.Encode()
+		} else {
+			result += "?" + u.RawQuery
+		}
+	}
+	return result
+}
+
+// canonicalHost 主机名小写、去除末尾的点，国际化域名转为punycode
+func canonicalHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+// canonicalPath 去除点段与重复斜杠，默认首页与末尾斜杠归一为空路径
+func canonicalPath(escapedPath string) string {
+	if escapedPath == "" || escapedPath == "/" {
+		return ""
+	}
+
+	cleaned := path.Clean("/" + escapedPath)
+	segments := strings.Split(cleaned, "/")
+	if last := segments[len(segments)-1]; indexPageRegexp.MatchString(last) {
+		segments = segments[:len(segments)-1]
+	}
+
+	cleaned = strings.Join(segments, "/")
+	if cleaned == "/" {
+		return ""
+	}
+	return cleaned
+}
+
+// legacyNormalizeURL 旧版字符串规范化，仅在URL无法解析时使用
+func legacyNormalizeURL(raw string) string {
+	raw = strings.TrimSuffix(raw, "/")
+	if strings.HasPrefix(raw, "http://") && strings.HasSuffix(raw, ":80") {
+		raw = strings.TrimSuffix(raw, ":80")
+	}
+	if strings.HasPrefix(raw, "https://") && strings.HasSuffix(raw, ":443") {
+		raw = strings.TrimSuffix(raw, ":443")
+	}
+	return raw
+}
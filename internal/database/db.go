@@ -2,50 +2,58 @@ package database
 
 import (
 	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/util"
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-// 统一 URL 去重格式处理
+// 统一 URL 去重格式处理（完整URL身份）
 func NormalizeURL(raw string) string {
-	raw = strings.TrimSpace(raw)
-	raw = strings.TrimSuffix(raw, "/")
-	if strings.HasPrefix(raw, "http://") && strings.HasSuffix(raw, ":80") {
-		raw = strings.TrimSuffix(raw, ":80")
-	}
-	if strings.HasPrefix(raw, "https://") && strings.HasSuffix(raw, ":443") {
-		raw = strings.TrimSuffix(raw, ":443")
-	}
-	return raw
+	return CanonicalizeURL(raw, IdentityURL)
 }
 
-// 合并字符串（去重 + 分号连接）
-func mergeValues(a, b string) string {
-	m := make(map[string]bool)
-	for _, val := range strings.Split(a+";"+b, ";") {
-		val = strings.TrimSpace(val)
-		if val != "" {
-			m[val] = true
+// assetKey 计算资产去重键：非web服务为 ip:port（IPv6 为 [ip]:port）；web资产按任务身份取 ip:port 或规范化URL
+// ip_port身份下缺少IP的web结果退回按完整URL去重
+func assetKey(r model.QueryResult, opts TaskOptions) (string, string) {
+	if !r.IsWeb() {
+		if r.Port == 0 && r.Host != "" {
+			return AssetKindDomain, "domain:" + strings.ToLower(r.Host)
 		}
+		return AssetKindService, net.JoinHostPort(r.IP, strconv.Itoa(r.Port))
 	}
-	var result []string
-	for k := range m {
-		result = append(result, k)
+	if opts.Identity == IdentityIPPort {
+		if r.IP != "" && r.Port > 0 {
+			return AssetKindWeb, net.JoinHostPort(r.IP, strconv.Itoa(r.Port))
+		}
+		return AssetKindWeb, CanonicalizeURL(r.URL, IdentityURL)
 	}
-	return strings.Join(result, ";")
+	return AssetKindWeb, CanonicalizeURL(r.URL, opts.Identity)
 }
 
-// InitDB 初始化 SQLite 数据库和数据表
-func InitDB(dbPath string, tableName string) (*sql.DB, error) {
+// sqliteBusyTimeout 写锁被其他进程占用时的等待时间（毫秒）
+const sqliteBusyTimeout = 30000
+
+// sqliteDSN 为数据库文件附加连接参数（对连接池中的每个连接生效）：
+// WAL 模式允许读写并发，busy_timeout 让并发写入排队等待而不是直接返回 SQLITE_BUSY，
+// 事务以 IMMEDIATE 开始，避免读锁升级写锁时因死锁检测立即失败
+func sqliteDSN(dbPath string) string {
+	return fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_txlock=immediate", dbPath, sqliteBusyTimeout)
+}
+
+// OpenDB 打开 SQLite 数据库，创建跨任务公共表并执行未完成的迁移，不创建任务表
+func OpenDB(dbPath string) (*sql.DB, error) {
 	os.MkdirAll(filepath.Dir(dbPath), os.ModePerm)
 
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, err
 	}
@@ -56,149 +64,385 @@ func InitDB(dbPath string, tableName string) (*sql.DB, error) {
 		return nil, err
 	}
 
-	createStmt := fmt.Sprintf(`
-CREATE TABLE IF NOT EXISTS %s (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    org_code TEXT,
-    domain TEXT,
-    host TEXT,
-    protocol TEXT,
-    url TEXT UNIQUE,
-    ip TEXT,
-    port INTEGER,
-    status_code INTEGER,
-    length INTEGER,
-    title TEXT,
-    source TEXT,
-    reliability INTEGER
-);
-`, tableName)
-
-	_, err = db.Exec(createStmt)
+	if err := initSchema(db); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// initSchema 创建跨任务公共表，并升级旧版 res.db 中的扁平任务表
+func initSchema(db *sql.DB) error {
+	if err := createInventorySchema(db); err != nil {
+		return err
+	}
+
+	if err := createTaskOptionsSchema(db); err != nil {
+		return err
+	}
+
+	if err := createTaskLockSchema(db); err != nil {
+		return err
+	}
+
+	if err := createTasksSchema(db); err != nil {
+		return err
+	}
+
+	if err := createQueriesSchema(db); err != nil {
+		return err
+	}
+
+	if err := migrate(db); err != nil {
+		return err
+	}
+
+	// 清单的全文索引依赖迁移补齐的列，在迁移之后创建
+	return ensureSearchIndex(db, inventorySearchIndex())
+}
+
+// InitDB 初始化 SQLite 数据库和数据表
+func InitDB(dbPath string, tableName string) (*sql.DB, error) {
+	db, err := OpenDB(dbPath)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := createTaskSchema(db, tableName); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
-// SaveResults 去重并写入数据库
+// TaskExists 检查任务（资产表）是否存在
+func TaskExists(db *sql.DB, tableName string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if DialectOf(db) == DialectPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	var count int
+	err := db.QueryRow(query, AssetTableName(tableName)).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// mergeListSQL 生成按发现顺序追加去重的分号列表合并表达式（用于标题、来源），当前值以 upsertAlias 限定
+func mergeListSQL(d Dialect, column string) string {
+	return fmt.Sprintf(`CASE
+        WHEN excluded.%[1]s = '' OR %[3]s > 0 THEN %[2]s.%[1]s
+        WHEN COALESCE(%[2]s.%[1]s, '') = '' THEN excluded.%[1]s
+        ELSE %[2]s.%[1]s || ';' || excluded.%[1]s
+    END`, column, upsertAlias, d.Instr(fmt.Sprintf("';' || %s.%s || ';'", upsertAlias, column), fmt.Sprintf("';' || excluded.%s || ';'", column)))
+}
+
+// splitUnits 拆分以分号分隔的单位列表，去除空值与重复
+func splitUnits(unit string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(unit, ";") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// stageTableName 批量写入使用的临时暂存表（连接级，随事务所在连接存在）
+const stageTableName = "result_stage"
+
+// stageColumns 暂存表的列，每条结果的每个归属单位一行
+// round 为该行资产键在本批中第几次出现：同一条 UPSERT 不能两次更新同一行（PostgreSQL 直接报错），按轮次依次合并
+var stageColumns = []string{
+	"seq", "round", "primary_row", "kind", "asset_key", "unit_name", "target", "target_row",
+	"url", "domain", "host", "protocol", "transport", "ip", "port", "status_code", "length", "title", "source", "reliability",
+	"server", "product", "os", "banner", "header", "cert_subject", "cert_san", "icp", "icp_company", "country", "province", "city", "asn", "org",
+	"first_seen", "last_seen", "icon_hash", "ip_provider", "field_sources",
+}
+
+// stageIntColumns 暂存表中的整数列，其余为文本列
+var stageIntColumns = map[string]bool{
+	"seq": true, "round": true, "primary_row": true, "target_row": true, "port": true, "status_code": true, "length": true, "reliability": true,
+}
+
+// stageColumnDefs 暂存表的列定义
+func stageColumnDefs() string {
+	defs := make([]string, 0, len(stageColumns))
+	for _, col := range stageColumns {
+		if stageIntColumns[col] {
+			defs = append(defs, col+" INTEGER")
+		} else {
+			defs = append(defs, col+" TEXT")
+		}
+	}
+	return strings.Join(defs, ", ")
+}
+
+// stageChunkSize 每条多行INSERT写入暂存表的行数，单条语句的绑定参数个数远低于 SQLite 与 PostgreSQL 的上限
+const stageChunkSize = 10
+
+// stageRow 将一条结果展开为暂存行的参数
+func stageRow(seq, round int, primary bool, kind, key, unit, url, fieldSources string, r model.QueryResult) []interface{} {
+	primaryRow := 0
+	if primary {
+		primaryRow = 1
+	}
+	return []interface{}{
+		seq, round, primaryRow, kind, key, unit, r.Target, r.TargetRow,
+		url, r.Domain, r.Host, r.Protocol, r.Transport, r.IP, r.Port, r.StatusCode, r.Length, r.Title, r.Source, r.Reliability,
+		r.Server, r.Product, r.OS, r.Banner, r.Header, r.CertSubject, r.CertSAN, r.ICP, r.ICPCompany, r.Country, r.Province, r.City, r.ASN, r.Org,
+		r.FirstSeen, r.LastSeen, r.IconHash, r.IPProvider, fieldSources,
+	}
+}
+
+// SaveResults 去重并写入数据库：每条结果记录为一次观测，并合并到对应资产
+// web资产按任务选项中的身份（完整URL、协议+主机+端口 或 ip:port）去重，非web服务按 ip:port 去重
+// 结果先以多行INSERT写入临时暂存表，再以集合语句完成单位、资产合并、观测与归属的写入，整批一个事务
 func SaveResults(db *sql.DB, tableName string, results []model.QueryResult) error {
-	// 先查询现有数据，用于去重处理
-	querySQL := fmt.Sprintf("SELECT title, source, reliability FROM %s WHERE url = ?", tableName)
-
-	insertSQL := fmt.Sprintf(`
-INSERT INTO %s (org_code, domain, host, protocol, url, ip, port, status_code, length, title, source, reliability)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT(url) DO UPDATE SET
-    title=?,
-    source=?,
-    reliability=?;
-`, tableName)
-
-	tx, err := db.Begin()
+	tx, err := beginTx(db)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	queryStmt, err := tx.Prepare(querySQL)
-	if err != nil {
+	if err := saveResults(tx, tableName, results); err != nil {
 		return err
 	}
-	defer queryStmt.Close()
+	return tx.Commit()
+}
 
-	insertStmt, err := tx.Prepare(insertSQL)
+// saveResults 在调用方的事务中完成 SaveResults 的写入
+func saveResults(tx Execer, tableName string, results []model.QueryResult) error {
+	opts, err := LoadTaskOptions(tx, tableName)
 	if err != nil {
-		return err
+		return fmt.Errorf("读取任务选项失败: %w", err)
 	}
-	defer insertStmt.Close()
-
-	for _, r := range results {
-		normURL := NormalizeURL(r.URL)
-
-		// 查询现有数据
-		var existingTitle, existingSource string
-		var existingReliability int
-		err := queryStmt.QueryRow(normURL).Scan(&existingTitle, &existingSource, &existingReliability)
-
-		if err == sql.ErrNoRows {
-			// 新记录，直接插入
-			_, err := insertStmt.Exec(
-				r.Unit,
-				r.Domain,
-				r.Host,
-				r.Protocol,
-				normURL,
-				r.IP,
-				r.Port,
-				r.StatusCode,
-				r.Length,
-				r.Title,
-				r.Source,
-				r.Reliability,
-				r.Title, // 用于ON CONFLICT
-				r.Source,
-				r.Reliability,
-			)
-			if err != nil {
-				log.Printf("insert error for URL %s: %v", normURL, err)
-				continue
-			}
-		} else if err != nil {
-			log.Printf("query error for URL %s: %v", normURL, err)
+
+	d := DialectOf(tx)
+	units := UnitTableName(tableName)
+	assets := AssetTableName(tableName)
+	observations := ObservationTableName(tableName)
+	assetUnits := AssetUnitTableName(tableName)
+	stageTable := d.tempTable(stageTableName)
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	// 展开暂存行：多个单位共享的结果每个单位一行，首个单位为主归属并产生观测记录
+	var rows [][]interface{}
+	occurrences := make(map[string]int)
+	for i, r := range results {
+		// IP统一为标准写法，同一IPv6地址的不同写法视为同一IP
+		r.IP = util.CanonicalIP(r.IP)
+		// 各平台只给出记录的更新时间：单条记录的首次发现即该时间，合并时 first_seen 取各次观测中最早者
+		if r.FirstSeen == "" {
+			r.FirstSeen = r.LastSeen
+		}
+		kind, key := assetKey(r, opts)
+		if kind == AssetKindService && (r.IP == "" || r.Port == 0) {
+			log.Printf("skip service without ip:port from %s: %s", r.Source, r.Host)
 			continue
-		} else {
-			// 记录已存在，合并数据
-			mergedTitle := mergeValues(existingTitle, r.Title)
-			mergedSource := mergeValues(existingSource, r.Source)
-			mergedReliability := existingReliability
-
-			// 根据reliability规则设置：Reliability 0是最高可信度，不能被覆盖
-			// 只有当新记录的reliability更低时，才更新为更低的reliability
-			if existingReliability == 0 {
-				// 如果现有记录是0（最高可信度），保持不变
-				mergedReliability = 0
-			} else if r.Reliability == 0 {
-				// 如果新记录是0（最高可信度），更新为0
-				mergedReliability = 0
-			} else if r.Reliability < existingReliability {
-				// 如果新记录的reliability更低，更新为更低的reliability
-				mergedReliability = r.Reliability
-			} else {
-				// 否则保持现有的reliability
-				mergedReliability = existingReliability
-			}
+		}
 
-			_, err := insertStmt.Exec(
-				r.Unit,
-				r.Domain,
-				r.Host,
-				r.Protocol,
-				normURL,
-				r.IP,
-				r.Port,
-				r.StatusCode,
-				r.Length,
-				r.Title,
-				r.Source,
-				r.Reliability,
-				mergedTitle, // 用于ON CONFLICT
-				mergedSource,
-				mergedReliability, // 使用合并后的reliability
-			)
-			if err != nil {
-				log.Printf("update error for URL %s: %v", normURL, err)
-				continue
-			}
+		url := ""
+		if kind == AssetKindWeb {
+			url = NormalizeURL(r.URL)
+		}
+
+		fieldSources := initialFieldSources(map[string]interface{}{
+			"url": url, "domain": r.Domain, "host": r.Host, "protocol": r.Protocol, "transport": r.Transport, "ip": r.IP,
+			"port": r.Port, "status_code": r.StatusCode, "length": r.Length, "title": r.Title,
+			"server": r.Server, "product": r.Product, "os": r.OS, "banner": r.Banner, "header": r.Header,
+			"cert_subject": r.CertSubject, "cert_san": r.CertSAN, "icp": r.ICP, "icp_company": r.ICPCompany,
+			"country": r.Country, "province": r.Province, "city": r.City, "asn": r.ASN, "org": r.Org, "icon_hash": r.IconHash,
+			"ip_provider": r.IPProvider,
+		}, r.Source)
+
+		unitNames := splitUnits(r.Unit)
+		if len(unitNames) == 0 {
+			unitNames = []string{""}
+		}
+		for j, name := range unitNames {
+			rows = append(rows, stageRow(i, occurrences[key], j == 0, kind, key, name, url, fieldSources, r))
+			occurrences[key]++
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	rounds := 0
+	for _, n := range occurrences {
+		if n > rounds {
+			rounds = n
 		}
 	}
 
-	return tx.Commit()
+	stmts := []string{
+		fmt.Sprintf(`CREATE TEMP TABLE IF NOT EXISTS %s (%s)`, stageTableName, stageColumnDefs()),
+		fmt.Sprintf(`DELETE FROM %s`, stageTable),
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	rowPlaceholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(stageColumns)), ", ") + ")"
+	for start := 0; start < len(rows); start += stageChunkSize {
+		end := start + stageChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		placeholders := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(stageColumns))
+		for _, row := range rows[start:end] {
+			placeholders = append(placeholders, rowPlaceholder)
+			args = append(args, row...)
+		}
+		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", stageTable, strings.Join(stageColumns, ", "), strings.Join(placeholders, ", "))
+		if _, err := tx.Exec(insertSQL, args...); err != nil {
+			return fmt.Errorf("写入暂存表失败: %w", err)
+		}
+	}
+
+	// 资产合并规则：
+	// - 各字段按任务选项中的字段策略合并（first / non_empty / newest / provider / union），field_sources 记录胜出值的来源平台
+	// - 单位名称与来源按发现顺序追加去重
+	// - 可信度取更高者（数值更小），Reliability 0 不会被覆盖
+	// - first_seen 取最早，last_seen 取最新
+	// 暂存行按轮次、轮内按 seq 顺序插入，同一批内命中同一资产的后续行在下一轮走 ON CONFLICT 合并
+	unitSQL := fmt.Sprintf(`
+INSERT INTO %s (name)
+SELECT DISTINCT unit_name FROM %s WHERE unit_name != ''
+ON CONFLICT(name) DO NOTHING`, units, stageTable)
+
+	assetSQL := fmt.Sprintf(`
+INSERT INTO %s AS t (kind, asset_key, unit_id, org_code, url, domain, host, protocol, transport, ip, port, status_code, length, title, source, reliability,
+    server, product, os, banner, header, cert_subject, cert_san, icp, icp_company, country, province, city, asn, org, first_seen, last_seen, icon_hash,
+    ip_provider, field_sources, created_at, updated_at)
+SELECT s.kind, s.asset_key, u.id, s.unit_name, s.url, s.domain, s.host, s.protocol, s.transport, s.ip, s.port, s.status_code, s.length, s.title, s.source, s.reliability,
+    s.server, s.product, s.os, s.banner, s.header, s.cert_subject, s.cert_san, s.icp, s.icp_company, s.country, s.province, s.city, s.asn, s.org,
+    s.first_seen, s.last_seen, s.icon_hash, s.ip_provider, s.field_sources, '%[5]s', '%[5]s'
+FROM %[2]s s LEFT JOIN %[3]s u ON u.name = s.unit_name
+WHERE s.round = ?
+ORDER BY s.seq, s.primary_row DESC
+ON CONFLICT(asset_key) DO UPDATE SET
+%[4]s,
+    org_code=%[6]s,
+    source=%[7]s,
+    reliability=%[8]s,
+    first_seen=CASE WHEN COALESCE(t.first_seen, '') = '' OR (excluded.first_seen != '' AND excluded.first_seen < t.first_seen) THEN excluded.first_seen ELSE t.first_seen END,
+    last_seen=CASE WHEN excluded.last_seen > COALESCE(t.last_seen, '') THEN excluded.last_seen ELSE t.last_seen END,
+    updated_at=excluded.updated_at`, assets, stageTable, units, fieldMergeSQL(d, opts), now, mergeListSQL(d, "org_code"), mergeListSQL(d, "source"),
+		d.least("t.reliability", "excluded.reliability"))
+
+	// 观测：每条结果一行（只取主归属行）
+	observationSQL := fmt.Sprintf(`
+INSERT INTO %s (asset_id, unit_id, source, reliability, url, domain, host, protocol, transport, ip, port, status_code, length, title,
+    server, product, os, banner, header, cert_subject, cert_san, icp, icp_company, country, province, city, asn, org, first_seen, last_seen, icon_hash,
+    ip_provider, observed_at)
+SELECT a.id, u.id, s.source, s.reliability, s.url, s.domain, s.host, s.protocol, s.transport, s.ip, s.port, s.status_code, s.length, s.title,
+    s.server, s.product, s.os, s.banner, s.header, s.cert_subject, s.cert_san, s.icp, s.icp_company, s.country, s.province, s.city, s.asn, s.org,
+    s.first_seen, s.last_seen, s.icon_hash, s.ip_provider, '%[5]s'
+FROM %[2]s s JOIN %[3]s a ON a.asset_key = s.asset_key LEFT JOIN %[4]s u ON u.name = s.unit_name
+WHERE s.primary_row = 1
+ORDER BY s.seq`, observations, stageTable, assets, units, now)
+
+	// 归属依据：同一单位由同一目标多次命中时合并来源平台
+	assetUnitSQL := fmt.Sprintf(`
+INSERT INTO %s AS t (asset_id, unit_id, target, target_row, source, observed_at)
+SELECT a.id, u.id, s.target, s.target_row, s.source, '%[5]s'
+FROM %[2]s s JOIN %[3]s a ON a.asset_key = s.asset_key JOIN %[4]s u ON u.name = s.unit_name
+WHERE s.round = ?
+ORDER BY s.seq
+ON CONFLICT(asset_id, unit_id, target) DO UPDATE SET
+    source=%[6]s`, assetUnits, stageTable, assets, units, now, mergeListSQL(d, "source"))
+
+	if _, err := tx.Exec(unitSQL); err != nil {
+		return fmt.Errorf("合并写入失败: %w", err)
+	}
+	for round := 0; round < rounds; round++ {
+		if _, err := tx.Exec(assetSQL, round); err != nil {
+			return fmt.Errorf("合并写入失败: %w", err)
+		}
+	}
+	if _, err := tx.Exec(observationSQL); err != nil {
+		return fmt.Errorf("合并写入失败: %w", err)
+	}
+	for round := 0; round < rounds; round++ {
+		if _, err := tx.Exec(assetUnitSQL, round); err != nil {
+			return fmt.Errorf("合并写入失败: %w", err)
+		}
+	}
+	if err := foldDomainAssets(tx, tableName); err != nil {
+		return fmt.Errorf("合并待验证域名失败: %w", err)
+	}
+	_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s`, stageTable))
+	return err
+}
+
+// foldDomainAssets 将已有同主机web资产的待验证域名并入该web资产（同主机有多个web资产时取编号最小者）：
+// 观测与归属记录转到web资产，单位与来源追加到web资产的列表中，待验证域名本身删除
+func foldDomainAssets(tx Execer, tableName string) error {
+	assets := AssetTableName(tableName)
+	rows, err := tx.Query(fmt.Sprintf(`SELECT d.id, MIN(w.id) FROM %[1]s d JOIN %[1]s w ON w.kind = '%[2]s' AND LOWER(w.host) = LOWER(d.host)
+WHERE d.kind = '%[3]s'
+GROUP BY d.id`, assets, AssetKindWeb, AssetKindDomain))
+	if err != nil {
+		return err
+	}
+	var pairs [][2]int64
+	for rows.Next() {
+		var domainID, webID int64
+		if err := rows.Scan(&domainID, &webID); err != nil {
+			rows.Close()
+			return err
+		}
+		pairs = append(pairs, [2]int64{domainID, webID})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	assetUnits := AssetUnitTableName(tableName)
+	for _, p := range pairs {
+		domainID, webID := p[0], p[1]
+		var webOrg, webSource, domainOrg, domainSource, domain string
+		err := tx.QueryRow(fmt.Sprintf(`SELECT COALESCE(w.org_code, ''), COALESCE(w.source, ''), COALESCE(d.org_code, ''), COALESCE(d.source, ''), COALESCE(d.domain, '')
+FROM %[1]s w, %[1]s d WHERE w.id = ? AND d.id = ?`, assets), webID, domainID).Scan(&webOrg, &webSource, &domainOrg, &domainSource, &domain)
+		if err != nil {
+			return err
+		}
+
+		stmts := []struct {
+			query string
+			args  []interface{}
+		}{
+			{fmt.Sprintf("UPDATE %s SET asset_id = ? WHERE asset_id = ?", ObservationTableName(tableName)), []interface{}{webID, domainID}},
+			{fmt.Sprintf(`INSERT INTO %[1]s (asset_id, unit_id, target, target_row, source, observed_at)
+SELECT ?, unit_id, target, target_row, source, observed_at FROM %[1]s WHERE asset_id = ?
+ON CONFLICT(asset_id, unit_id, target) DO NOTHING`, assetUnits), []interface{}{webID, domainID}},
+			{fmt.Sprintf("DELETE FROM %s WHERE asset_id = ?", assetUnits), []interface{}{domainID}},
+			{fmt.Sprintf("UPDATE %s SET org_code = ?, source = ?, domain = COALESCE(NULLIF(domain, ''), ?) WHERE id = ?", assets),
+				[]interface{}{strings.Join(splitUnits(webOrg+";"+domainOrg), ";"), strings.Join(splitUnits(webSource+";"+domainSource), ";"), domain, webID}},
+			{fmt.Sprintf("DELETE FROM %s WHERE id = ?", assets), []interface{}{domainID}},
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // IsIPExists 检查指定IP是否在数据库中已存在
-func IsIPExists(db *sql.DB, tableName, ip string) (bool, error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE ip = ?", tableName)
+func IsIPExists(db Querier, tableName, ip string) (bool, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s AS a WHERE ip = ?", AssetIPSubquery(tableName))
 	var count int
 	err := db.QueryRow(query, ip).Scan(&count)
 	if err != nil {
@@ -208,8 +452,8 @@ func IsIPExists(db *sql.DB, tableName, ip string) (bool, error) {
 }
 
 // GetExistingIPs 获取数据库中已存在的所有IP
-func GetExistingIPs(db *sql.DB, tableName string) (map[string]bool, error) {
-	query := fmt.Sprintf("SELECT DISTINCT ip FROM %s WHERE ip IS NOT NULL AND ip != ''", tableName)
+func GetExistingIPs(db Querier, tableName string) (map[string]bool, error) {
+	query := fmt.Sprintf("SELECT DISTINCT ip FROM %s AS a WHERE ip IS NOT NULL AND ip != ''", AssetIPSubquery(tableName))
 	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
@@ -222,7 +466,7 @@ func GetExistingIPs(db *sql.DB, tableName string) (map[string]bool, error) {
 		if err := rows.Scan(&ip); err != nil {
 			continue
 		}
-		existingIPs[ip] = true
+		existingIPs[util.CanonicalIP(ip)] = true
 	}
 
 	return existingIPs, nil
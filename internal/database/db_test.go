@@ -0,0 +1,214 @@
+package database
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openTestDB 在临时目录中创建 res.db
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "res.db"))
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// initTestTask 按选项创建任务
+func initTestTask(t *testing.T, db *sql.DB, tableName string, opts TaskOptions) {
+	t.Helper()
+	if err := createTaskSchema(db, tableName); err != nil {
+		t.Fatalf("createTaskSchema: %v", err)
+	}
+	if err := SaveTaskOptions(db, tableName, opts); err != nil {
+		t.Fatalf("SaveTaskOptions: %v", err)
+	}
+}
+
+// assetColumns 按资产键读取资产的若干列，数值列转为文本
+func assetColumns(t *testing.T, db Querier, tableName, key string, columns ...string) map[string]string {
+	t.Helper()
+	got := make(map[string]string, len(columns))
+	for _, c := range columns {
+		var v string
+		query := fmt.Sprintf("SELECT COALESCE(CAST(%s AS TEXT), '') FROM %s WHERE asset_key = ?", c, AssetTableName(tableName))
+		if err := db.QueryRow(query, key).Scan(&v); err != nil {
+			t.Fatalf("读取资产 %s 的 %s 失败: %v", key, c, err)
+		}
+		got[c] = v
+	}
+	return got
+}
+
+// countRows 返回表的行数
+func countRows(t *testing.T, db Querier, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&n); err != nil {
+		t.Fatalf("统计 %s 失败: %v", table, err)
+	}
+	return n
+}
+
+func TestSaveResultsMergePolicies(t *testing.T) {
+	web := func(unit, source, url string) model.QueryResult {
+		return model.QueryResult{Unit: unit, Source: source, URL: url, Host: "a.example.com", Protocol: "http", IP: "10.0.0.1", Port: 80}
+	}
+	with := func(r model.QueryResult, set func(*model.QueryResult)) model.QueryResult {
+		set(&r)
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		opts    TaskOptions
+		batches [][]model.QueryResult
+		key     string
+		want    map[string]string
+	}{
+		{
+			name: "默认策略：标题合并全部值，其余字段取首个非空值",
+			opts: DefaultTaskOptions(),
+			batches: [][]model.QueryResult{{
+				with(web("A", "fofa", "http://a.example.com"), func(r *model.QueryResult) { r.Title = "登录" }),
+				with(web("B", "quake", "HTTP://a.example.com:80/"), func(r *model.QueryResult) {
+					r.Title, r.StatusCode, r.Server = "首页", 200, "nginx"
+				}),
+				with(web("A", "hunter", "http://a.example.com/index.html"), func(r *model.QueryResult) {
+					r.Title, r.StatusCode, r.Server = "登录", 302, "apache"
+				}),
+			}},
+			key: "http://a.example.com",
+			want: map[string]string{
+				"title": "登录;首页", "status_code": "200", "server": "nginx", "source": "fofa;quake;hunter", "org_code": "A;B",
+			},
+		},
+		{
+			name: "provider策略按平台优先级取值，与写入顺序无关",
+			opts: TaskOptions{Fields: map[string]string{"status_code": PolicyProvider}},
+			batches: [][]model.QueryResult{
+				{with(web("A", "quake", "http://a.example.com"), func(r *model.QueryResult) { r.StatusCode = 200 })},
+				{with(web("A", "fofa", "http://a.example.com"), func(r *model.QueryResult) { r.StatusCode = 301 })},
+			},
+			key:  "http://a.example.com",
+			want: map[string]string{"status_code": "200", "field_sources": `{"host":"quake","ip":"quake","port":"quake","protocol":"quake","status_code":"quake","url":"quake"}`},
+		},
+		{
+			name: "newest策略取最近发现的值，first_seen取最早、last_seen取最晚",
+			opts: TaskOptions{Fields: map[string]string{"title": PolicyNewest}},
+			batches: [][]model.QueryResult{{
+				with(web("A", "fofa", "http://a.example.com"), func(r *model.QueryResult) { r.Title, r.LastSeen = "新标题", "2025-07-02 00:00:00" }),
+				with(web("A", "hunter", "http://a.example.com"), func(r *model.QueryResult) { r.Title, r.LastSeen = "旧标题", "2025-07-01 00:00:00" }),
+			}},
+			key: "http://a.example.com",
+			want: map[string]string{
+				"title": "新标题", "first_seen": "2025-07-01 00:00:00", "last_seen": "2025-07-02 00:00:00",
+			},
+		},
+		{
+			name: "可信度取更可信者",
+			opts: DefaultTaskOptions(),
+			batches: [][]model.QueryResult{
+				{with(web("A", "subfinder", "http://a.example.com"), func(r *model.QueryResult) { r.Reliability = 2 })},
+				{with(web("A", "fofa", "http://a.example.com"), func(r *model.QueryResult) { r.Reliability = 0 })},
+				{with(web("A", "fofa", "http://a.example.com"), func(r *model.QueryResult) { r.Reliability = 1 })},
+			},
+			key:  "http://a.example.com",
+			want: map[string]string{"reliability": "0"},
+		},
+		{
+			name: "ip_port身份合并同一端口上的不同域名",
+			opts: TaskOptions{Identity: IdentityIPPort},
+			batches: [][]model.QueryResult{{
+				web("A", "fofa", "http://a.example.com"),
+				with(web("A", "hunter", "http://b.example.com"), func(r *model.QueryResult) { r.Host = "b.example.com" }),
+			}},
+			key:  "10.0.0.1:80",
+			want: map[string]string{"url": "http://a.example.com;http://b.example.com", "host": "a.example.com;b.example.com", "port": "80"},
+		},
+		{
+			name: "host身份合并同一站点的不同路径",
+			opts: TaskOptions{Identity: IdentityHost},
+			batches: [][]model.QueryResult{{
+				web("A", "fofa", "http://a.example.com/login"),
+				web("A", "fofa", "http://a.example.com/admin"),
+			}},
+			key:  "http://a.example.com",
+			want: map[string]string{"url": "http://a.example.com/login;http://a.example.com/admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			initTestTask(t, db, "task_1", tt.opts)
+			for _, batch := range tt.batches {
+				if err := SaveResults(db, "task_1", batch); err != nil {
+					t.Fatalf("SaveResults: %v", err)
+				}
+			}
+			if n := countRows(t, db, AssetTableName("task_1")); n != 1 {
+				t.Fatalf("资产数 = %d，应合并为1个", n)
+			}
+
+			columns := make([]string, 0, len(tt.want))
+			for c := range tt.want {
+				columns = append(columns, c)
+			}
+			if got := assetColumns(t, db, "task_1", tt.key, columns...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("资产字段:\n got  %v\n want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveResultsOwnership(t *testing.T) {
+	db := openTestDB(t)
+	initTestTask(t, db, "task_1", DefaultTaskOptions())
+
+	results := []model.QueryResult{
+		{Unit: "A;B", Target: "example.com", TargetRow: 3, Source: "fofa", URL: "http://a.example.com", Host: "a.example.com", Protocol: "http", IP: "10.0.0.1", Port: 80},
+		{Unit: "B", Target: "b.txt", TargetRow: 1, Source: "hunter", URL: "http://a.example.com", Host: "a.example.com", Protocol: "http", IP: "10.0.0.1", Port: 80},
+		{Unit: "B", Target: "b.txt", TargetRow: 1, Source: "quake", URL: "http://a.example.com", Host: "a.example.com", Protocol: "http", IP: "10.0.0.1", Port: 80},
+		{Unit: "C", Target: "c.txt", Source: "quake", Host: "c.example.com", Protocol: "ssh", Port: 22},
+	}
+	if err := SaveResults(db, "task_1", results); err != nil {
+		t.Fatalf("SaveResults: %v", err)
+	}
+
+	if n := countRows(t, db, AssetTableName("task_1")); n != 1 {
+		t.Errorf("资产数 = %d，缺少ip:port的服务不应入库", n)
+	}
+	if n := countRows(t, db, ObservationTableName("task_1")); n != 3 {
+		t.Errorf("观测数 = %d，每条入库结果应各有一条观测", n)
+	}
+	if got := assetColumns(t, db, "task_1", "http://a.example.com", "org_code")["org_code"]; got != "A;B" {
+		t.Errorf("org_code = %q, want %q", got, "A;B")
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT u.name, au.target, au.target_row, au.source FROM %s au JOIN %s u ON u.id = au.unit_id
+ORDER BY u.name, au.target`, AssetUnitTableName("task_1"), UnitTableName("task_1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var unit, target, source string
+		var row int
+		if err := rows.Scan(&unit, &target, &row, &source); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s|%s|%d|%s", unit, target, row, source))
+	}
+	want := []string{"A|example.com|3|fofa", "B|b.txt|1|hunter;quake", "B|example.com|3|fofa"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("资产归属:\n got  %v\n want %v", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Dialect SQL方言：任务表结构与合并语句在 SQLite 与 PostgreSQL 间的差异集中在这里
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// DialectOf 根据连接使用的驱动判断方言；事务（dbTx）与 Storage 直接报告自身的方言
+func DialectOf(db Querier) Dialect {
+	switch v := db.(type) {
+	case *sql.DB:
+		if _, ok := v.Driver().(postgresDriver); ok {
+			return DialectPostgres
+		}
+	case interface{ Dialect() Dialect }:
+		return v.Dialect()
+	}
+	return DialectSQLite
+}
+
+// dbTx 携带方言的事务，使建表、写入等函数可以在迁移这类外层事务中执行
+type dbTx struct {
+	*sql.Tx
+	dialect Dialect
+}
+
+func (t dbTx) Dialect() Dialect {
+	return t.dialect
+}
+
+// beginTx 开始事务；SQLite 连接以 BEGIN IMMEDIATE 开始，事务开始即持有写锁
+func beginTx(db *sql.DB) (dbTx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return dbTx{}, err
+	}
+	return dbTx{Tx: tx, dialect: DialectOf(db)}, nil
+}
+
+// serialKey 自增主键列定义
+func (d Dialect) serialKey() string {
+	if d == DialectPostgres {
+		return "id SERIAL PRIMARY KEY"
+	}
+	return "id INTEGER PRIMARY KEY AUTOINCREMENT"
+}
+
+// createView 建视图语句开头；PostgreSQL 不支持 CREATE VIEW IF NOT EXISTS
+func (d Dialect) createView(name string) string {
+	if d == DialectPostgres {
+		return "CREATE OR REPLACE VIEW " + name
+	}
+	return "CREATE VIEW IF NOT EXISTS " + name
+}
+
+// tempTable 临时表的限定名
+func (d Dialect) tempTable(name string) string {
+	if d == DialectPostgres {
+		return "pg_temp." + name
+	}
+	return "temp." + name
+}
+
+// least 两个值中的较小者
+func (d Dialect) least(a, b string) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("LEAST(%s, %s)", a, b)
+	}
+	return fmt.Sprintf("MIN(%s, %s)", a, b)
+}
+
+// Instr 子串在字符串中的位置（从1开始，不存在时为0）
+func (d Dialect) Instr(s, sub string) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("strpos(%s, %s)", s, sub)
+	}
+	return fmt.Sprintf("instr(%s, %s)", s, sub)
+}
+
+// GroupConcatDistinct 分组内去重后以逗号拼接的聚合表达式
+func (d Dialect) GroupConcatDistinct(column string) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("string_agg(DISTINCT %s, ',')", column)
+	}
+	return fmt.Sprintf("GROUP_CONCAT(DISTINCT %s)", column)
+}
+
+// jsonGet 读取JSON文本中的顶层字段（文本值）
+func (d Dialect) jsonGet(doc, key string) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("(COALESCE(%s, '{}')::jsonb ->> %s)", doc, sqlQuote(key))
+	}
+	return fmt.Sprintf("json_extract(COALESCE(%s, '{}'), '$.%s')", doc, key)
+}
+
+// jsonPatch 将 键, 值 表达式对合并进JSON文本，值为 NULL 的键被忽略（已存在时删除）
+func (d Dialect) jsonPatch(doc string, pairs []string) string {
+	if d == DialectPostgres {
+		return fmt.Sprintf("jsonb_strip_nulls(COALESCE(%s, '{}')::jsonb || jsonb_build_object(\n        %s))::text",
+			doc, strings.Join(pairs, ",\n        "))
+	}
+	return fmt.Sprintf("json_patch(COALESCE(%s, '{}'), json_object(\n        %s))", doc, strings.Join(pairs, ",\n        "))
+}
@@ -0,0 +1,257 @@
+package database
+
+import (
+	"cyberspace_mapping_summary/internal/util"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 跨任务资产清单表：按规范化URL / 类型+ip:port 长期追踪资产，与各任务的去重规则无关
+const (
+	InventoryTable     = "inventory"
+	InventoryTaskTable = "inventory_tasks"
+)
+
+// 清单资产状态
+const (
+	InventoryStatusActive  = "active"  // 最近一次覆盖该单位的任务中仍被发现
+	InventoryStatusMissing = "missing" // 最近一次覆盖该单位的任务中未再出现
+)
+
+// InventoryStats 单次任务更新清单后的统计
+type InventoryStats struct {
+	New     int // 首次出现的资产
+	Seen    int // 本次任务发现的资产总数
+	Missing int // 本次任务覆盖的单位中不再出现的资产
+}
+
+// createInventorySchema 创建跨任务资产清单表
+func createInventorySchema(db *sql.DB) error {
+	d := DialectOf(db)
+	stmts := []string{
+		fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    %s,
+    asset_key TEXT UNIQUE,
+    kind TEXT,
+    org_code TEXT,
+    url TEXT,
+    domain TEXT,
+    host TEXT,
+    protocol TEXT,
+    ip TEXT,
+    port INTEGER,
+    title TEXT,
+    status_code INTEGER,
+    source TEXT,
+    status TEXT,
+    first_seen TEXT,
+    last_seen TEXT,
+    first_task TEXT,
+    last_task TEXT,
+    seen_count INTEGER DEFAULT 0,
+    server TEXT,
+    banner TEXT,
+    reliability INTEGER
+);`, InventoryTable, d.serialKey()),
+		fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    inventory_id INTEGER NOT NULL REFERENCES %s(id),
+    task_id TEXT NOT NULL,
+    seen_at TEXT,
+    PRIMARY KEY (inventory_id, task_id)
+);`, InventoryTaskTable, InventoryTable),
+	}
+
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateInventory 在任务结束时将本次任务的资产合并进跨任务清单
+// 本次发现的资产标记为active并刷新last_seen；markMissing 为 true 时（完整的测绘任务），本次任务覆盖的单位中未再出现的资产标记为missing，
+// 导入的工具结果只覆盖单位的一部分资产，不做消失判断
+func UpdateInventory(db *sql.DB, tableName, taskID string, markMissing bool) (InventoryStats, error) {
+	tx, err := beginTx(db)
+	if err != nil {
+		return InventoryStats{}, err
+	}
+	defer tx.Rollback()
+
+	stats, err := updateInventory(tx, tableName, taskID, markMissing)
+	if err != nil {
+		return stats, err
+	}
+	return stats, tx.Commit()
+}
+
+// inventoryStageTableName 更新清单时使用的临时暂存表：每个清单资产键一行，对应任务中的一个资产
+const inventoryStageTableName = "inventory_stage"
+
+// updateInventory 在调用方的事务中完成 UpdateInventory 的写入
+func updateInventory(tx Execer, tableName, taskID string, markMissing bool) (InventoryStats, error) {
+	var stats InventoryStats
+	d := DialectOf(tx)
+	assets := AssetTableName(tableName)
+	units := UnitTableName(tableName)
+	stageTable := d.tempTable(inventoryStageTableName)
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	if err := stageInventoryKeys(tx, tableName); err != nil {
+		return stats, err
+	}
+
+	// 首次出现的资产数量（写入前统计）
+	newQuery := fmt.Sprintf(`SELECT COUNT(*) FROM %s s WHERE NOT EXISTS (SELECT 1 FROM %s i WHERE i.asset_key = s.asset_key)`, stageTable, InventoryTable)
+	if err := tx.QueryRow(newQuery).Scan(&stats.New); err != nil {
+		return stats, err
+	}
+
+	upsertSQL := fmt.Sprintf(`
+INSERT INTO %s AS t (asset_key, kind, org_code, url, domain, host, protocol, ip, port, title, status_code, source, status,
+    first_seen, last_seen, first_task, last_task, seen_count, server, banner, reliability)
+SELECT s.asset_key, a.kind, COALESCE(NULLIF(a.org_code, ''), u.name, ''), s.url, a.domain, a.host, a.protocol, a.ip, a.port, a.title, a.status_code, a.source, ?,
+    ?, ?, ?, ?, 1, a.server, a.banner, a.reliability
+FROM %s s JOIN %s a ON a.id = s.asset_id LEFT JOIN %s u ON u.id = a.unit_id
+WHERE true
+ON CONFLICT(asset_key) DO UPDATE SET
+    kind=excluded.kind,
+    org_code=COALESCE(NULLIF(excluded.org_code, ''), t.org_code),
+    domain=COALESCE(NULLIF(excluded.domain, ''), t.domain),
+    host=COALESCE(NULLIF(excluded.host, ''), t.host),
+    protocol=COALESCE(NULLIF(excluded.protocol, ''), t.protocol),
+    ip=COALESCE(NULLIF(excluded.ip, ''), t.ip),
+    port=excluded.port,
+    title=excluded.title,
+    status_code=excluded.status_code,
+    source=excluded.source,
+    server=COALESCE(NULLIF(excluded.server, ''), t.server),
+    banner=COALESCE(NULLIF(excluded.banner, ''), t.banner),
+    reliability=excluded.reliability,
+    status=excluded.status,
+    last_seen=excluded.last_seen,
+    last_task=excluded.last_task,
+    seen_count=t.seen_count + CASE WHEN t.last_task = excluded.last_task THEN 0 ELSE 1 END;
+`, InventoryTable, stageTable, assets, units)
+	result, err := tx.Exec(upsertSQL, InventoryStatusActive, now, now, taskID, taskID)
+	if err != nil {
+		return stats, fmt.Errorf("更新资产清单失败: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		stats.Seen = int(n)
+	}
+
+	linkSQL := fmt.Sprintf(`
+INSERT INTO %s (inventory_id, task_id, seen_at)
+SELECT i.id, ?, ? FROM %s i JOIN %s s ON s.asset_key = i.asset_key
+WHERE true
+ON CONFLICT(inventory_id, task_id) DO NOTHING;
+`, InventoryTaskTable, InventoryTable, stageTable)
+	if _, err := tx.Exec(linkSQL, taskID, now); err != nil {
+		return stats, fmt.Errorf("记录清单任务关联失败: %w", err)
+	}
+	if !markMissing {
+		return stats, nil
+	}
+
+	// 仅对本次任务覆盖的单位判断消失，避免把其他项目的资产误标为missing；org_code 可能包含多个单位
+	missingSQL := fmt.Sprintf(`
+UPDATE %s SET status = ?
+WHERE last_task != ? AND status = ? AND EXISTS (SELECT 1 FROM %s u WHERE %s > 0);
+`, InventoryTable, units, DialectOf(tx).Instr("';' || org_code || ';'", "';' || u.name || ';'"))
+	result, err = tx.Exec(missingSQL, InventoryStatusMissing, taskID, InventoryStatusActive)
+	if err != nil {
+		return stats, fmt.Errorf("标记消失资产失败: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		stats.Missing = int(n)
+	}
+	return stats, nil
+}
+
+// stageInventoryKeys 按观测记录计算本次任务各资产的清单资产键并写入暂存表，待验证域名不记入清单
+// 任务按 host / ip_port 去重时一个资产可能包含多个URL，每个URL在清单中各为一条；
+// 同一个键对应多个资产时取编号最小的资产，保证一条 UPSERT 不会两次更新清单中的同一行
+func stageInventoryKeys(tx Execer, tableName string) error {
+	stageTable := DialectOf(tx).tempTable(inventoryStageTableName)
+	rows, err := tx.Query(fmt.Sprintf(`SELECT a.id, a.kind, COALESCE(NULLIF(o.url, ''), a.url, ''), COALESCE(NULLIF(o.ip, ''), a.ip, ''), COALESCE(NULLIF(o.port, 0), a.port, 0)
+FROM %s a LEFT JOIN %s o ON o.asset_id = a.id
+WHERE a.kind != '%s'
+ORDER BY a.id`, AssetTableName(tableName), ObservationTableName(tableName), AssetKindDomain))
+	if err != nil {
+		return err
+	}
+	type stageRow struct {
+		assetID int64
+		url     string
+	}
+	staged := make(map[string]stageRow)
+	var keys []string
+	for rows.Next() {
+		var id int64
+		var kind, url, ip string
+		var port int
+		if err := rows.Scan(&id, &kind, &url, &ip, &port); err != nil {
+			rows.Close()
+			return err
+		}
+		key := InventoryKey(kind, url, ip, port)
+		if _, ok := staged[key]; ok {
+			continue
+		}
+		if kind != AssetKindWeb {
+			url = ""
+		}
+		staged[key] = stageRow{assetID: id, url: url}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmts := []string{
+		fmt.Sprintf(`CREATE TEMP TABLE IF NOT EXISTS %s (asset_key TEXT, asset_id INTEGER, url TEXT)`, inventoryStageTableName),
+		fmt.Sprintf(`DELETE FROM %s`, stageTable),
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	for start := 0; start < len(keys); start += stageChunkSize {
+		end := start + stageChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		placeholders := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*3)
+		for _, key := range keys[start:end] {
+			placeholders = append(placeholders, "(?, ?, ?)")
+			args = append(args, key, staged[key].assetID, staged[key].url)
+		}
+		insertSQL := fmt.Sprintf("INSERT INTO %s (asset_key, asset_id, url) VALUES %s", stageTable, strings.Join(placeholders, ", "))
+		if _, err := tx.Exec(insertSQL, args...); err != nil {
+			return fmt.Errorf("写入清单暂存表失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// InventoryKey 清单资产键，与任务的去重规则无关：web资产为规范化的完整URL（合并了多个URL时取首个），
+// 非web服务与缺少URL的web资产为 类型:ip:port（如 service:10.0.0.1:22），两类资产的键不会重合
+func InventoryKey(kind, url, ip string, port int) string {
+	if kind == AssetKindWeb {
+		if first := strings.TrimSpace(strings.Split(url, ";")[0]); first != "" {
+			return CanonicalizeURL(first, IdentityURL)
+		}
+	}
+	return kind + ":" + net.JoinHostPort(util.CanonicalIP(ip), strconv.Itoa(port))
+}
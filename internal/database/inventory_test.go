@@ -0,0 +1,97 @@
+package database
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"reflect"
+	"testing"
+)
+
+// inventoryStatus 返回清单中各资产键的状态
+func inventoryStatus(t *testing.T, db Querier) map[string]string {
+	t.Helper()
+	rows, err := db.Query("SELECT asset_key, status FROM " + InventoryTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	status := make(map[string]string)
+	for rows.Next() {
+		var key, s string
+		if err := rows.Scan(&key, &s); err != nil {
+			t.Fatal(err)
+		}
+		status[key] = s
+	}
+	return status
+}
+
+func TestUpdateInventory(t *testing.T) {
+	a := model.QueryResult{Unit: "A", Source: "fofa", URL: "http://a.example.com", Host: "a.example.com", Protocol: "http", IP: "10.0.0.1", Port: 80}
+	b := model.QueryResult{Unit: "A", Source: "fofa", URL: "http://b.example.com", Host: "b.example.com", Protocol: "http", IP: "10.0.0.1", Port: 80}
+	ssh := model.QueryResult{Unit: "A", Source: "nmap", Host: "10.0.0.1", Protocol: "ssh", IP: "10.0.0.1", Port: 22}
+	domain := model.QueryResult{Unit: "A", Source: "subfinder", Host: "c.example.com", Domain: "c.example.com"}
+
+	tests := []struct {
+		name        string
+		opts        TaskOptions
+		second      []model.QueryResult
+		markMissing bool
+		stats       InventoryStats
+		want        map[string]string
+	}{
+		{
+			name:        "完整任务中未再出现的资产标记为missing",
+			opts:        DefaultTaskOptions(),
+			second:      []model.QueryResult{a},
+			markMissing: true,
+			stats:       InventoryStats{New: 0, Seen: 1, Missing: 1},
+			want:        map[string]string{"http://a.example.com": InventoryStatusActive, "http://b.example.com": InventoryStatusMissing},
+		},
+		{
+			name:        "导入的部分结果不标记其他资产消失，待验证域名不记入清单",
+			opts:        DefaultTaskOptions(),
+			second:      []model.QueryResult{domain, ssh},
+			markMissing: false,
+			stats:       InventoryStats{New: 1, Seen: 1},
+			want: map[string]string{
+				"http://a.example.com": InventoryStatusActive, "http://b.example.com": InventoryStatusActive, "service:10.0.0.1:22": InventoryStatusActive,
+			},
+		},
+		{
+			name:        "资产键与任务的去重身份无关",
+			opts:        TaskOptions{Identity: IdentityIPPort},
+			second:      []model.QueryResult{a, b},
+			markMissing: true,
+			stats:       InventoryStats{New: 0, Seen: 2},
+			want:        map[string]string{"http://a.example.com": InventoryStatusActive, "http://b.example.com": InventoryStatusActive},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			initTestTask(t, db, "task_1", DefaultTaskOptions())
+			if err := SaveResults(db, "task_1", []model.QueryResult{a, b}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := UpdateInventory(db, "task_1", "1", true); err != nil {
+				t.Fatalf("UpdateInventory: %v", err)
+			}
+
+			initTestTask(t, db, "task_2", tt.opts)
+			if err := SaveResults(db, "task_2", tt.second); err != nil {
+				t.Fatal(err)
+			}
+			stats, err := UpdateInventory(db, "task_2", "2", tt.markMissing)
+			if err != nil {
+				t.Fatalf("UpdateInventory: %v", err)
+			}
+			if stats != tt.stats {
+				t.Errorf("统计 = %+v, want %+v", stats, tt.stats)
+			}
+			if got := inventoryStatus(t, db); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("清单状态:\n got  %v\n want %v", got, tt.want)
+			}
+		})
+	}
+}
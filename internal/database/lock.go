@@ -0,0 +1,125 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// TaskLockTable 任务锁表：同一任务同一时间只允许一个进程写入
+const TaskLockTable = "task_locks"
+
+// ErrTaskLocked 任务正被其他进程使用
+var ErrTaskLocked = errors.New("任务正被其他进程使用")
+
+// TaskLock 任务锁的持有者
+type TaskLock struct {
+	TableName  string
+	Owner      string // 用户名@主机名
+	Host       string
+	PID        int
+	AcquiredAt string
+}
+
+// createTaskLockSchema 创建任务锁表
+func createTaskLockSchema(db *sql.DB) error {
+	_, err := db.Exec(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    table_name TEXT PRIMARY KEY,
+    owner TEXT,
+    host TEXT,
+    pid INTEGER,
+    acquired_at TEXT
+);`, TaskLockTable))
+	return err
+}
+
+// lockOwner 当前进程的锁持有者信息
+func lockOwner() (owner, host string, pid int) {
+	host, _ = os.Hostname()
+	user := os.Getenv("USER")
+	if user == "" {
+		user = os.Getenv("USERNAME")
+	}
+	return user + "@" + host, host, os.Getpid()
+}
+
+// processAlive 判断本机进程是否仍在运行
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Windows 上 FindProcess 成功即表示进程存在
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	// 进程存在但属于其他用户时返回 EPERM，其余错误（ESRCH、进程已结束）视为不存在
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// GetTaskLock 读取任务锁，未加锁时返回 nil
+func GetTaskLock(db Querier, tableName string) (*TaskLock, error) {
+	lock := TaskLock{TableName: tableName}
+	err := db.QueryRow(fmt.Sprintf("SELECT COALESCE(owner, ''), COALESCE(host, ''), COALESCE(pid, 0), COALESCE(acquired_at, '') FROM %s WHERE table_name = ?", TaskLockTable), tableName).
+		Scan(&lock.Owner, &lock.Host, &lock.PID, &lock.AcquiredAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// LockTask 占用任务锁；锁已被本进程持有时直接返回，被本机已退出的进程遗留时接管，其余情况返回 ErrTaskLocked
+func LockTask(db *sql.DB, tableName string) error {
+	owner, host, pid := lockOwner()
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	result, err := db.Exec(fmt.Sprintf("INSERT INTO %s (table_name, owner, host, pid, acquired_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT(table_name) DO NOTHING", TaskLockTable),
+		tableName, owner, host, pid, now)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 1 {
+		return nil
+	}
+
+	lock, err := GetTaskLock(db, tableName)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		// 持有者恰好在两次查询之间释放了锁
+		return LockTask(db, tableName)
+	}
+	if lock.Host == host && lock.PID == pid {
+		return nil
+	}
+	if lock.Host == host && !processAlive(lock.PID) {
+		result, err := db.Exec(fmt.Sprintf("UPDATE %s SET owner = ?, pid = ?, acquired_at = ? WHERE table_name = ? AND host = ? AND pid = ?", TaskLockTable),
+			owner, pid, now, tableName, lock.Host, lock.PID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 1 {
+			log.Printf("[*] 接管已退出进程（%d）遗留的任务锁: %s", lock.PID, tableName)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s（%s，进程 %d，%s 起）", ErrTaskLocked, tableName, lock.Owner, lock.PID, lock.AcquiredAt)
+}
+
+// UnlockTask 释放本进程持有的任务锁
+func UnlockTask(db *sql.DB, tableName string) error {
+	_, host, pid := lockOwner()
+	_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE table_name = ? AND host = ? AND pid = ?", TaskLockTable), tableName, host, pid)
+	return err
+}
@@ -0,0 +1,317 @@
+package database
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TaskSummary 任务概况：任务元数据与各表行数
+type TaskSummary struct {
+	TableName    string
+	TaskID       string
+	Name         string
+	Status       string // 旧版本生成的任务没有元数据，为空
+	StartedAt    string // 无元数据时取资产最早写入时间
+	FinishedAt   string
+	WebAssets    int
+	Services     int
+	Domains      int // 待验证域名（被动收集、尚无同主机web资产的子域名）
+	Observations int
+	Units        int
+}
+
+// ListTaskTables 按名称排序返回数据库中全部任务的表名（以资产表识别）
+func ListTaskTables(db *sql.DB) ([]string, error) {
+	query := `SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'task\_%' ESCAPE '\'`
+	if DialectOf(db) == DialectPostgres {
+		query = `SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name LIKE 'task\_%' ESCAPE '\'`
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		suffix := "_assets"
+		if strings.HasSuffix(name, suffix) && !hasTaskSuffix(strings.TrimSuffix(name, suffix)) {
+			names = append(names, strings.TrimSuffix(name, suffix))
+		}
+	}
+	sort.Strings(names)
+	return names, rows.Err()
+}
+
+// GetTaskSummary 统计单个任务的资产、服务、观测与单位数量，并附带任务元数据
+func GetTaskSummary(db Querier, tableName string) (TaskSummary, error) {
+	s := TaskSummary{TableName: tableName, TaskID: strings.TrimPrefix(tableName, "task_")}
+
+	err := db.QueryRow(fmt.Sprintf(`SELECT
+    COALESCE(SUM(CASE WHEN kind = '%s' THEN 1 ELSE 0 END), 0),
+    COALESCE(SUM(CASE WHEN kind = '%s' THEN 1 ELSE 0 END), 0),
+    COALESCE(SUM(CASE WHEN kind = '%s' THEN 1 ELSE 0 END), 0),
+    COALESCE(MIN(created_at), '')
+FROM %s`, AssetKindWeb, AssetKindService, AssetKindDomain, AssetTableName(tableName))).Scan(&s.WebAssets, &s.Services, &s.Domains, &s.StartedAt)
+	if err != nil {
+		return s, err
+	}
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", ObservationTableName(tableName))).Scan(&s.Observations); err != nil {
+		return s, err
+	}
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE name <> ''", UnitTableName(tableName))).Scan(&s.Units); err != nil {
+		return s, err
+	}
+
+	rec, err := LoadTaskRecord(db, tableName)
+	if err != nil {
+		return s, err
+	}
+	if rec != nil {
+		if rec.TaskID != "" {
+			s.TaskID = rec.TaskID
+		}
+		s.Name = rec.Name
+		s.Status = rec.Status
+		if rec.StartedAt != "" {
+			s.StartedAt = rec.StartedAt
+		}
+		s.FinishedAt = rec.FinishedAt
+	}
+	return s, nil
+}
+
+// ListTasks 返回全部任务的概况，按任务表名（即创建时间）排序
+func ListTasks(db *sql.DB) ([]TaskSummary, error) {
+	names, err := ListTaskTables(db)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]TaskSummary, 0, len(names))
+	for _, name := range names {
+		s, err := GetTaskSummary(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("统计任务 %s 失败: %w", name, err)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+// FindTaskByName 按项目名称查找任务表名；同名任务（如每月复查同一项目）取最新的一个，未找到时返回空字符串
+func FindTaskByName(db Querier, name string) (string, error) {
+	var tableName string
+	err := db.QueryRow(fmt.Sprintf("SELECT table_name FROM %s WHERE name = ? ORDER BY table_name DESC LIMIT 1", TasksTable), name).Scan(&tableName)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return tableName, err
+}
+
+// SetTaskName 设置任务的项目名称；name 为空时清除名称
+func SetTaskName(db *sql.DB, tableName, name string) error {
+	_, err := db.Exec(fmt.Sprintf(`INSERT INTO %s (table_name, task_id, name) VALUES (?, ?, ?)
+ON CONFLICT(table_name) DO UPDATE SET name = excluded.name`, TasksTable),
+		tableName, strings.TrimPrefix(tableName, "task_"), name)
+	return err
+}
+
+// DeleteTask 删除任务的全部表、视图与元数据（任务选项、任务元数据、查询审计）
+// 跨任务清单保留该任务留下的发现记录；任务正被其他进程使用时返回 ErrTaskLocked
+func DeleteTask(db *sql.DB, tableName string) error {
+	lock, err := GetTaskLock(db, tableName)
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		// 本进程持有或本机已退出进程遗留的锁随任务一并删除
+		_, host, pid := lockOwner()
+		self := lock.Host == host && lock.PID == pid
+		stale := lock.Host == host && !processAlive(lock.PID)
+		if !self && !stale {
+			return fmt.Errorf("%w: %s（%s，进程 %d）", ErrTaskLocked, tableName, lock.Owner, lock.PID)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 先删视图与全文索引，再按外键依赖从子表到父表删除（资产表上的索引同步触发器随表删除）
+	stmts := []string{
+		fmt.Sprintf("DROP VIEW IF EXISTS %s", tableName),
+		fmt.Sprintf("DROP VIEW IF EXISTS %s", ServiceTableName(tableName)),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", SearchIndexName(tableName)),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", AssetUnitTableName(tableName)),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", ObservationTableName(tableName)),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", AssetTableName(tableName)),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", UnitTableName(tableName)),
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{TaskOptionsTable, TasksTable, QueriesTable, TaskLockTable} {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE table_name = ?", table), tableName); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ownershipRow 资产归属表中的一行
+type ownershipRow struct {
+	unit      string
+	target    string
+	targetRow int
+	source    string
+	used      bool
+}
+
+// ReadTaskResults 将任务还原为查询结果：每条观测一条结果，按写入顺序排列
+// 观测只记录主归属单位，同一次发现（相同查询目标与来源）的其他归属单位从资产归属表补回；
+// 未能对应到观测的归属记录以该资产首条观测补出一条结果，保证再次写入后归属与依据不丢失
+func ReadTaskResults(db Querier, tableName string) ([]model.QueryResult, error) {
+	units := UnitTableName(tableName)
+
+	owners := make(map[int64][]*ownershipRow)
+	rows, err := db.Query(fmt.Sprintf(`SELECT au.asset_id, COALESCE(u.name, ''), COALESCE(au.target, ''), COALESCE(au.target_row, 0), COALESCE(au.source, '')
+FROM %s au JOIN %s u ON u.id = au.unit_id
+ORDER BY au.asset_id, COALESCE(au.observed_at, ''), au.target_row`, AssetUnitTableName(tableName), units))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var assetID int64
+		o := &ownershipRow{}
+		if err := rows.Scan(&assetID, &o.unit, &o.target, &o.targetRow, &o.source); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		owners[assetID] = append(owners[assetID], o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(fmt.Sprintf(`SELECT o.asset_id, COALESCE(u.name, ''), COALESCE(o.source, ''), COALESCE(o.reliability, 0),
+    COALESCE(o.url, ''), COALESCE(o.domain, ''), COALESCE(o.host, ''), COALESCE(o.protocol, ''), COALESCE(o.transport, ''), COALESCE(o.ip, ''),
+    COALESCE(o.port, 0), COALESCE(o.status_code, 0), COALESCE(o.length, 0), COALESCE(o.title, ''),
+    COALESCE(o.server, ''), COALESCE(o.product, ''), COALESCE(o.os, ''), COALESCE(o.banner, ''), COALESCE(o.header, ''),
+    COALESCE(o.cert_subject, ''), COALESCE(o.cert_san, ''), COALESCE(o.icp, ''), COALESCE(o.icp_company, ''),
+    COALESCE(o.country, ''), COALESCE(o.province, ''), COALESCE(o.city, ''), COALESCE(o.asn, ''), COALESCE(o.org, ''),
+    COALESCE(o.first_seen, ''), COALESCE(o.last_seen, ''), COALESCE(o.icon_hash, ''), COALESCE(o.ip_provider, '')
+FROM %s o LEFT JOIN %s u ON u.id = o.unit_id
+ORDER BY o.id`, ObservationTableName(tableName), units))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []model.QueryResult
+	var assetOrder []int64
+	firstResult := make(map[int64]model.QueryResult)
+	for rows.Next() {
+		var assetID int64
+		var r model.QueryResult
+		err := rows.Scan(&assetID, &r.Unit, &r.Source, &r.Reliability,
+			&r.URL, &r.Domain, &r.Host, &r.Protocol, &r.Transport, &r.IP,
+			&r.Port, &r.StatusCode, &r.Length, &r.Title,
+			&r.Server, &r.Product, &r.OS, &r.Banner, &r.Header,
+			&r.CertSubject, &r.CertSAN, &r.ICP, &r.ICPCompany,
+			&r.Country, &r.Province, &r.City, &r.ASN, &r.Org,
+			&r.FirstSeen, &r.LastSeen, &r.IconHash, &r.IPProvider)
+		if err != nil {
+			return nil, err
+		}
+
+		// 找到本次发现的主归属记录，再补回同一查询目标与来源下的其他单位
+		var primary *ownershipRow
+		for _, o := range owners[assetID] {
+			if !o.used && o.unit == r.Unit && o.source == r.Source {
+				primary = o
+				break
+			}
+		}
+		if primary != nil {
+			r.Target = primary.target
+			r.TargetRow = primary.targetRow
+			unitNames := []string{r.Unit}
+			primary.used = true
+			for _, o := range owners[assetID] {
+				if !o.used && o.target == primary.target && o.source == primary.source {
+					unitNames = append(unitNames, o.unit)
+					o.used = true
+				}
+			}
+			r.Unit = strings.Join(unitNames, ";")
+		}
+
+		if _, ok := firstResult[assetID]; !ok {
+			firstResult[assetID] = r
+			assetOrder = append(assetOrder, assetID)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, assetID := range assetOrder {
+		for _, o := range owners[assetID] {
+			if o.used {
+				continue
+			}
+			r := firstResult[assetID]
+			r.Unit = o.unit
+			r.Target = o.target
+			r.TargetRow = o.targetRow
+			if o.source != "" {
+				r.Source = o.source
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+// mergeChunkSize 合并任务时每批写入的结果数
+const mergeChunkSize = 1000
+
+// MergeTasks 将多个任务按写入顺序依次还原为查询结果，以 SaveResults 的去重合并规则写入目标任务
+// 目标任务须已由 InitTask 创建；返回写入的结果数
+func MergeTasks(db *sql.DB, target string, sources []string) (int, error) {
+	if len(sources) == 0 {
+		return 0, errors.New("未指定要合并的任务")
+	}
+	total := 0
+	for _, source := range sources {
+		results, err := ReadTaskResults(db, source)
+		if err != nil {
+			return total, fmt.Errorf("读取任务 %s 失败: %w", source, err)
+		}
+		for start := 0; start < len(results); start += mergeChunkSize {
+			end := start + mergeChunkSize
+			if end > len(results) {
+				end = len(results)
+			}
+			if err := SaveResults(db, target, results[start:end]); err != nil {
+				return total, fmt.Errorf("写入任务 %s 的结果失败: %w", source, err)
+			}
+			total += end - start
+		}
+	}
+	return total, nil
+}
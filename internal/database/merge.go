@@ -0,0 +1,209 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 字段合并策略：同一资产被多条结果命中时，各字段取值的规则
+const (
+	PolicyFirst    = "first"     // 保留首次写入的值
+	PolicyNonEmpty = "non_empty" // 当前值为空（文本为空、数值为0）时才采用新值
+	PolicyNewest   = "newest"    // 新值非空且其last_seen不早于当前值时采用新值
+	PolicyProvider = "provider"  // 按平台优先级采用，优先级见 TaskOptions.Providers
+	PolicyUnion    = "union"     // 按发现顺序追加去重，以分号分隔（仅文本字段）
+)
+
+// mergeField 参与策略合并的资产字段
+type mergeField struct {
+	Column  string
+	Numeric bool
+}
+
+// mergeFields 可配置合并策略的字段，顺序与资产表一致
+var mergeFields = []mergeField{
+	{"url", false},
+	{"domain", false},
+	{"host", false},
+	{"protocol", false},
+	{"transport", false},
+	{"ip", false},
+	{"port", true},
+	{"status_code", true},
+	{"length", true},
+	{"title", false},
+	{"server", false},
+	{"product", false},
+	{"os", false},
+	{"banner", false},
+	{"header", false},
+	{"cert_subject", false},
+	{"cert_san", false},
+	{"icp", false},
+	{"icp_company", false},
+	{"country", false},
+	{"province", false},
+	{"city", false},
+	{"asn", false},
+	{"org", false},
+	{"icon_hash", false},
+	{"ip_provider", false},
+}
+
+// DefaultProviders 默认平台优先级：Quake与Hunter返回真实HTTP状态，FOFA状态码常为0
+var DefaultProviders = []string{"quake", "hunter", "fofa"}
+
+// defaultFieldPolicy 返回字段的默认合并策略
+// 身份字段跟随身份合并方式，端口保留首个值，标题合并全部值，其余字段取首个非空值
+func defaultFieldPolicy(column, identityMerge string) string {
+	switch column {
+	case "url", "domain", "host", "protocol":
+		if identityMerge == MergeUnion {
+			return PolicyUnion
+		}
+		if column == "url" {
+			return PolicyFirst
+		}
+		return PolicyNonEmpty
+	case "port":
+		return PolicyFirst
+	case "title":
+		return PolicyUnion
+	}
+	return PolicyNonEmpty
+}
+
+// normalizeFieldPolicies 校验字段策略并为未配置的字段补齐默认策略
+func normalizeFieldPolicies(policies map[string]string, identityMerge string) (map[string]string, error) {
+	known := make(map[string]mergeField, len(mergeFields))
+	for _, f := range mergeFields {
+		known[f.Column] = f
+	}
+
+	result := make(map[string]string, len(mergeFields))
+	for column, policy := range policies {
+		f, ok := known[column]
+		if !ok {
+			return nil, fmt.Errorf("字段 %s 不支持配置合并策略", column)
+		}
+		switch policy {
+		case PolicyFirst, PolicyNonEmpty, PolicyNewest, PolicyProvider:
+		case PolicyUnion:
+			if f.Numeric {
+				return nil, fmt.Errorf("数值字段 %s 不支持 union 合并", column)
+			}
+		default:
+			return nil, fmt.Errorf("字段 %s 的合并策略 %q 不受支持", column, policy)
+		}
+		result[column] = policy
+	}
+
+	for _, f := range mergeFields {
+		if _, ok := result[f.Column]; !ok {
+			result[f.Column] = defaultFieldPolicy(f.Column, identityMerge)
+		}
+	}
+	return result, nil
+}
+
+// sqlQuote 转义SQL字符串字面量
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// emptySQL 判断字段值是否为空
+func emptySQL(expr string, numeric bool) string {
+	if numeric {
+		return fmt.Sprintf("COALESCE(%s, 0) = 0", expr)
+	}
+	return fmt.Sprintf("COALESCE(%s, '') = ''", expr)
+}
+
+// providerRankSQL 生成平台优先级表达式，未列出的平台排在最后
+func providerRankSQL(expr string, providers []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CASE lower(COALESCE(%s, ''))", expr)
+	for i, p := range providers {
+		fmt.Fprintf(&b, " WHEN %s THEN %d", sqlQuote(strings.ToLower(p)), i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(providers))
+	return b.String()
+}
+
+// upsertAlias UPSERT 目标表的别名，ON CONFLICT 中以它限定当前值（PostgreSQL 要求限定，否则与 excluded 歧义）
+const upsertAlias = "t"
+
+// fieldSourceSQL 读取字段当前取值的来源平台
+func fieldSourceSQL(d Dialect, column string) string {
+	return d.jsonGet(upsertAlias+".field_sources", column)
+}
+
+// takeNewSQL 生成“新值胜出（或参与合并）”的判断条件，upsertAlias 前缀的列为当前值
+func takeNewSQL(d Dialect, f mergeField, policy string, providers []string) string {
+	cur, inc := upsertAlias+"."+f.Column, "excluded."+f.Column
+	switch policy {
+	case PolicyNonEmpty:
+		return fmt.Sprintf("(%s AND NOT %s)", emptySQL(cur, f.Numeric), emptySQL(inc, f.Numeric))
+	case PolicyNewest:
+		return fmt.Sprintf("(NOT %s AND (%s OR COALESCE(excluded.last_seen, '') >= COALESCE(%s.last_seen, '')))",
+			emptySQL(inc, f.Numeric), emptySQL(cur, f.Numeric), upsertAlias)
+	case PolicyProvider:
+		return fmt.Sprintf("(NOT %s AND (%s OR %s < %s))",
+			emptySQL(inc, f.Numeric), emptySQL(cur, f.Numeric),
+			providerRankSQL("excluded.source", providers), providerRankSQL(fieldSourceSQL(d, f.Column), providers))
+	case PolicyUnion:
+		return fmt.Sprintf("(NOT %s AND %s = 0)",
+			emptySQL(inc, false), d.Instr("';' || COALESCE("+cur+", '') || ';'", "';' || "+inc+" || ';'"))
+	}
+	return "false"
+}
+
+// fieldMergeSQL 生成资产UPSERT中各策略字段的SET子句，以及记录胜出来源的 field_sources 更新
+// 来源记录为 {字段: 平台}，union字段记录所有贡献过取值的平台
+func fieldMergeSQL(d Dialect, opts TaskOptions) string {
+	var sets, sources []string
+	for _, f := range mergeFields {
+		policy := opts.Fields[f.Column]
+		cond := takeNewSQL(d, f, policy, opts.Providers)
+		src := fieldSourceSQL(d, f.Column)
+		cur := upsertAlias + "." + f.Column
+
+		if policy == PolicyUnion {
+			sets = append(sets, fmt.Sprintf("    %s=%s", f.Column, mergeListSQL(d, f.Column)))
+			sources = append(sources, fmt.Sprintf(`%s, CASE
+        WHEN NOT %s THEN %s
+        WHEN COALESCE(%s, '') = '' THEN excluded.source
+        WHEN %s > 0 THEN %s
+        ELSE %s || ';' || excluded.source
+    END`, sqlQuote(f.Column), cond, src, src, d.Instr("';' || "+src+" || ';'", "';' || excluded.source || ';'"), src, src))
+			continue
+		}
+
+		sets = append(sets, fmt.Sprintf("    %s=CASE WHEN %s THEN excluded.%s ELSE %s END", f.Column, cond, f.Column, cur))
+		sources = append(sources, fmt.Sprintf("%s, CASE WHEN %s THEN excluded.source ELSE %s END", sqlQuote(f.Column), cond, src))
+	}
+
+	// 值为 null 的键被忽略，未取得值的字段不会留下空记录
+	sets = append(sets, "    field_sources="+d.jsonPatch(upsertAlias+".field_sources", sources))
+	return strings.Join(sets, ",\n")
+}
+
+// initialFieldSources 新资产首次写入时的来源记录：所有非空字段都来自本条结果
+func initialFieldSources(values map[string]interface{}, source string) string {
+	sources := make(map[string]string)
+	for _, f := range mergeFields {
+		switch v := values[f.Column].(type) {
+		case string:
+			if v != "" {
+				sources[f.Column] = source
+			}
+		case int:
+			if v != 0 {
+				sources[f.Column] = source
+			}
+		}
+	}
+	data, _ := json.Marshal(sources)
+	return string(data)
+}
@@ -0,0 +1,268 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// DatabaseMergeStats 合并一个外部 res.db 的统计
+type DatabaseMergeStats struct {
+	Tasks            []string // 导入的任务表
+	Skipped          []string // 目标库中已存在而跳过的任务表
+	Results          int      // 写入的结果数
+	InventoryNew     int      // 清单中新增的资产
+	InventoryUpdated int      // 清单中已有、按来源库更新的资产
+}
+
+// MergeDatabase 将外部 res.db（已打开并升级到当前结构）中的任务与跨任务清单合并进目标库，origin 记录来源文件
+// 任务按原表名导入：目标库中不存在的任务以 SaveResults 的去重合并规则写入，同时复制任务选项、元数据与查询审计记录；
+// 目标库中已存在的同名任务视为同一任务（重复合并同一文件，或同事之间已拷贝过）跳过，因此可重复执行；
+// 每个任务在一个事务中导入，中途失败时不会留下只导入了一部分的任务。
+// 清单按 asset_key 对齐：首次发现取更早者，其余字段取最近发现更晚的一方，发现记录合并后重新计算发现次数
+func MergeDatabase(db, src *sql.DB, origin string) (DatabaseMergeStats, error) {
+	var stats DatabaseMergeStats
+
+	tables, err := ListTaskTables(src)
+	if err != nil {
+		return stats, fmt.Errorf("列出来源任务失败: %w", err)
+	}
+	for _, tableName := range tables {
+		exists, err := TaskExists(db, tableName)
+		if err != nil {
+			return stats, err
+		}
+		if exists {
+			stats.Skipped = append(stats.Skipped, tableName)
+			continue
+		}
+
+		n, err := copyTask(db, src, tableName, origin)
+		stats.Results += n
+		if err != nil {
+			return stats, fmt.Errorf("导入任务 %s 失败: %w", tableName, err)
+		}
+		stats.Tasks = append(stats.Tasks, tableName)
+	}
+
+	stats.InventoryNew, stats.InventoryUpdated, err = mergeInventory(db, src)
+	if err != nil {
+		return stats, fmt.Errorf("合并资产清单失败: %w", err)
+	}
+	return stats, nil
+}
+
+// copyTask 以来源任务的去重规则在目标库创建同名任务，在一个事务中写入全部结果、元数据与查询审计记录
+func copyTask(db, src *sql.DB, tableName, origin string) (int, error) {
+	if err := LockTask(db, tableName); err != nil {
+		return 0, err
+	}
+	defer UnlockTask(db, tableName)
+
+	opts, err := LoadTaskOptions(src, tableName)
+	if err != nil {
+		return 0, err
+	}
+	rec, err := LoadTaskRecord(src, tableName)
+	if err != nil {
+		return 0, err
+	}
+	if rec == nil {
+		// 旧版本生成的任务没有元数据
+		rec = &TaskRecord{TaskID: strings.TrimPrefix(tableName, "task_"), TableName: tableName}
+	}
+	rec.ImportedFrom = origin
+
+	results, err := ReadTaskResults(src, tableName)
+	if err != nil {
+		return 0, err
+	}
+	logs, err := ReadQueryLogs(src, tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	// 来源库先读完再开始事务：SQLite 目标库的写锁在事务期间一直持有
+	tx, err := beginTx(db)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := createTaskSchema(tx, tableName); err != nil {
+		return 0, err
+	}
+	if err := SaveTaskOptions(tx, tableName, opts); err != nil {
+		return 0, err
+	}
+	for start := 0; start < len(results); start += mergeChunkSize {
+		end := start + mergeChunkSize
+		if end > len(results) {
+			end = len(results)
+		}
+		if err := saveResults(tx, tableName, results[start:end]); err != nil {
+			return 0, err
+		}
+	}
+	for _, entry := range logs {
+		if err := LogQuery(tx, entry); err != nil {
+			return 0, err
+		}
+	}
+	if err := SaveTaskRecord(tx, *rec); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(results), nil
+}
+
+// inventoryColumns 清单合并时复制的列（发现次数在合并发现记录后重新计算）
+var inventoryColumns = []string{
+	"asset_key", "kind", "org_code", "url", "domain", "host", "protocol", "ip", "port", "title", "status_code", "source",
+	"status", "first_seen", "last_seen", "first_task", "last_task", "server", "banner", "reliability",
+}
+
+// inventoryNewerColumns 以最近发现更晚的一方为准的列
+var inventoryNewerColumns = []string{
+	"kind", "org_code", "url", "domain", "host", "protocol", "ip", "port", "title", "status_code", "source",
+	"status", "last_task", "server", "banner", "reliability",
+}
+
+// mergeInventory 将来源库的跨任务清单与发现记录合并进目标库，返回新增与更新的资产数
+func mergeInventory(db, src *sql.DB) (int, int, error) {
+	selectCols := make([]string, len(inventoryColumns))
+	for i, c := range inventoryColumns {
+		switch c {
+		case "port", "status_code", "reliability":
+			selectCols[i] = fmt.Sprintf("COALESCE(%s, 0)", c)
+		default:
+			selectCols[i] = fmt.Sprintf("COALESCE(%s, '')", c)
+		}
+	}
+	rows, err := src.Query(fmt.Sprintf("SELECT id, %s FROM %s ORDER BY id", strings.Join(selectCols, ", "), InventoryTable))
+	if err != nil {
+		return 0, 0, err
+	}
+	type inventoryRow struct {
+		id     int64
+		values []interface{}
+	}
+	var items []inventoryRow
+	for rows.Next() {
+		var id int64
+		var port, statusCode, reliability int
+		text := make([]string, len(inventoryColumns))
+		dest := []interface{}{&id}
+		for i, c := range inventoryColumns {
+			switch c {
+			case "port":
+				dest = append(dest, &port)
+			case "status_code":
+				dest = append(dest, &statusCode)
+			case "reliability":
+				dest = append(dest, &reliability)
+			default:
+				dest = append(dest, &text[i])
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		values := make([]interface{}, len(inventoryColumns))
+		for i, c := range inventoryColumns {
+			switch c {
+			case "port":
+				values[i] = port
+			case "status_code":
+				values[i] = statusCode
+			case "reliability":
+				values[i] = reliability
+			default:
+				values[i] = text[i]
+			}
+		}
+		items = append(items, inventoryRow{id: id, values: values})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	seen := make(map[int64][][2]string)
+	rows, err = src.Query(fmt.Sprintf("SELECT inventory_id, task_id, COALESCE(seen_at, '') FROM %s", InventoryTaskTable))
+	if err != nil {
+		return 0, 0, err
+	}
+	for rows.Next() {
+		var id int64
+		var taskID, seenAt string
+		if err := rows.Scan(&id, &taskID, &seenAt); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		seen[id] = append(seen[id], [2]string{taskID, seenAt})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	var sets []string
+	for _, c := range inventoryNewerColumns {
+		sets = append(sets, fmt.Sprintf("%[1]s=CASE WHEN COALESCE(excluded.last_seen, '') > COALESCE(t.last_seen, '') THEN excluded.%[1]s ELSE t.%[1]s END", c))
+	}
+	sets = append(sets,
+		"first_task=CASE WHEN COALESCE(excluded.first_seen, '') < COALESCE(t.first_seen, '') THEN excluded.first_task ELSE t.first_task END",
+		"first_seen=CASE WHEN COALESCE(excluded.first_seen, '') < COALESCE(t.first_seen, '') THEN excluded.first_seen ELSE t.first_seen END",
+		"last_seen=CASE WHEN COALESCE(excluded.last_seen, '') > COALESCE(t.last_seen, '') THEN excluded.last_seen ELSE t.last_seen END",
+	)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(inventoryColumns)), ", ")
+	upsertSQL := fmt.Sprintf(`INSERT INTO %s AS t (%s) VALUES (%s)
+ON CONFLICT(asset_key) DO UPDATE SET
+    %s`, InventoryTable, strings.Join(inventoryColumns, ", "), placeholders, strings.Join(sets, ",\n    "))
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var added, updated int
+	for _, item := range items {
+		key := item.values[0]
+		var exists int
+		if err := tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE asset_key = ?", InventoryTable), key).Scan(&exists); err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.Exec(upsertSQL, item.values...); err != nil {
+			return 0, 0, err
+		}
+		if exists > 0 {
+			updated++
+		} else {
+			added++
+		}
+
+		var id int64
+		if err := tx.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE asset_key = ?", InventoryTable), key).Scan(&id); err != nil {
+			return 0, 0, err
+		}
+		for _, s := range seen[item.id] {
+			_, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (inventory_id, task_id, seen_at) VALUES (?, ?, ?) ON CONFLICT(inventory_id, task_id) DO NOTHING", InventoryTaskTable),
+				id, s[0], s[1])
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		// 发现次数以合并后的发现记录为准，同一任务在两个库中只计一次
+		_, err := tx.Exec(fmt.Sprintf("UPDATE %s SET seen_count = COALESCE(NULLIF((SELECT COUNT(*) FROM %s WHERE inventory_id = ?), 0), seen_count) WHERE id = ?",
+			InventoryTable, InventoryTaskTable), id, id)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return added, updated, tx.Commit()
+}
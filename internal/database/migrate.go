@@ -0,0 +1,317 @@
+package database
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersionTable 记录已执行的数据库迁移
+const SchemaVersionTable = "schema_version"
+
+// migration 一次数据库结构迁移，按版本号顺序执行且只执行一次
+type migration struct {
+	Version     int
+	Description string
+	Apply       func(db Execer) error // 在迁移事务中执行
+}
+
+// migrations 全部迁移，只允许在末尾追加，已发布的迁移不得修改
+// 公共表与任务表均按当前结构以 CREATE TABLE IF NOT EXISTS 创建，迁移只负责把旧版本的数据升级到当前结构
+var migrations = []migration{
+	{1, "旧版扁平任务表拆分为资产、观测、单位表", migrateLegacyTaskTables},
+}
+
+// taskTableSuffixes 任务附属表的后缀，用于从表名中识别任务主名
+var taskTableSuffixes = []string{"_assets", "_observations", "_units", "_asset_units", "_services", "_legacy",
+	"_fts", "_fts_data", "_fts_idx", "_fts_docsize", "_fts_config"}
+
+// createSchemaVersionTable 创建迁移记录表
+func createSchemaVersionTable(db *sql.DB) error {
+	_, err := db.Exec(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    version INTEGER PRIMARY KEY,
+    description TEXT,
+    applied_at TEXT
+);`, SchemaVersionTable))
+	return err
+}
+
+// SchemaVersion 返回数据库当前的结构版本，未执行过迁移时为0
+func SchemaVersion(db Querier) (int, error) {
+	var version int
+	err := db.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", SchemaVersionTable)).Scan(&version)
+	return version, err
+}
+
+// migrate 按顺序执行尚未执行的迁移，使旧版 res.db 中的扁平任务表原地升级到当前结构
+func migrate(db *sql.DB) error {
+	if err := createSchemaVersionTable(db); err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("数据库迁移 v%d 失败: %w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration 在一个事务中执行迁移并记录版本：中途失败时整体回滚，库保持迁移前的状态，下次打开时重新执行
+// 事务先取得写锁（SQLite 以 BEGIN IMMEDIATE 开始，PostgreSQL 持有咨询锁），多个进程同时打开旧库时依次执行，
+// 取得锁后重新读取版本，已由其他进程执行过的迁移直接跳过
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := beginTx(db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if tx.Dialect() == DialectPostgres {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(?)", postgresMigrateLock); err != nil {
+			return err
+		}
+	}
+	current, err := SchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if current >= m.Version {
+		return nil
+	}
+
+	// 迁移对 SQLite 与 PostgreSQL 均执行，表结构查询按方言区分
+	log.Printf("[*] 数据库迁移 v%d: %s", m.Version, m.Description)
+	if err := m.Apply(tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (version, description, applied_at) VALUES (?, ?, ?)", SchemaVersionTable),
+		m.Version, m.Description, time.Now().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// objectType 返回表或视图的类型（table / view），不存在时为空
+func objectType(db Querier, name string) (string, error) {
+	query := "SELECT type FROM sqlite_master WHERE name = ?"
+	if DialectOf(db) == DialectPostgres {
+		query = `SELECT CASE table_type WHEN 'VIEW' THEN 'view' ELSE 'table' END FROM information_schema.tables
+WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	var t string
+	err := db.QueryRow(query, name).Scan(&t)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return t, err
+}
+
+// tableColumns 返回表的列名集合
+func tableColumns(db Querier, table string) (map[string]bool, error) {
+	if DialectOf(db) == DialectPostgres {
+		return postgresTableColumns(db, table)
+	}
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// postgresTableColumns 从 information_schema 读取 PostgreSQL 表的列名集合
+func postgresTableColumns(db Querier, table string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// flatTaskTables 按名称排序返回旧版扁平任务表：不带附属表后缀的任务表（当前结构中任务主名是兼容视图）
+func flatTaskTables(db Querier) ([]string, error) {
+	query := `SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'task\_%' ESCAPE '\'`
+	if DialectOf(db) == DialectPostgres {
+		query = `SELECT table_name FROM information_schema.tables
+WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' AND table_name LIKE 'task\_%' ESCAPE '\'`
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if !hasTaskSuffix(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, rows.Err()
+}
+
+// hasTaskSuffix 判断表名是否为任务附属表
+func hasTaskSuffix(name string) bool {
+	for _, suffix := range taskTableSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyColumns 旧版扁平表的列，与 QueryResult 字段一一对应
+var legacyColumns = []string{
+	"org_code", "domain", "host", "protocol", "url", "ip", "port", "status_code", "length", "title", "source", "reliability",
+	"transport", "server", "product", "os", "banner", "header", "cert_subject", "cert_san", "icp", "icp_company",
+	"country", "province", "city", "asn", "org", "first_seen", "last_seen", "icon_hash",
+}
+
+// legacyNumericColumns 旧版扁平表中的数值列
+var legacyNumericColumns = map[string]bool{"port": true, "status_code": true, "length": true, "reliability": true}
+
+// readLegacyRows 读取旧版扁平任务表为 QueryResult，旧版表只有其中一部分列，缺少的列按空值处理
+func readLegacyRows(db Querier, table string) ([]model.QueryResult, error) {
+	existing, err := tableColumns(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	selects := make([]string, 0, len(legacyColumns))
+	for _, col := range legacyColumns {
+		switch {
+		case !existing[col] && legacyNumericColumns[col]:
+			selects = append(selects, "0")
+		case !existing[col]:
+			selects = append(selects, "''")
+		case legacyNumericColumns[col]:
+			selects = append(selects, fmt.Sprintf("COALESCE(%s, 0)", col))
+		default:
+			selects = append(selects, fmt.Sprintf("COALESCE(%s, '')", col))
+		}
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s ORDER BY id", strings.Join(selects, ", "), table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []model.QueryResult
+	for rows.Next() {
+		var r model.QueryResult
+		err := rows.Scan(&r.Unit, &r.Domain, &r.Host, &r.Protocol, &r.URL, &r.IP, &r.Port, &r.StatusCode, &r.Length, &r.Title, &r.Source, &r.Reliability,
+			&r.Transport, &r.Server, &r.Product, &r.OS, &r.Banner, &r.Header, &r.CertSubject, &r.CertSAN, &r.ICP, &r.ICPCompany,
+			&r.Country, &r.Province, &r.City, &r.ASN, &r.Org, &r.FirstSeen, &r.LastSeen, &r.IconHash)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// migrateLegacyTaskTables v1：将旧版扁平任务表按当前规则重新写入资产/观测/单位表，并按任务顺序补录跨任务清单
+// 旧表先改名为 _legacy 再写入新表；写入的结果数与读取的行数一致时删除旧表，否则保留旧表供核对
+func migrateLegacyTaskTables(db Execer) error {
+	names, err := flatTaskTables(db)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		columns, err := tableColumns(db, name)
+		if err != nil {
+			return err
+		}
+		if !columns["url"] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s_legacy", name, name)); err != nil {
+			return err
+		}
+		if err := migrateLegacyTask(db, name); err != nil {
+			return err
+		}
+		if _, err := updateInventory(db, name, strings.TrimPrefix(name, "task_"), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLegacyTask 将已改名为 _legacy 的旧版任务表写入任务的资产/观测/单位表
+func migrateLegacyTask(db Execer, name string) error {
+	legacy := name + "_legacy"
+	if err := createTaskSchema(db, name); err != nil {
+		return err
+	}
+	if err := SaveTaskOptions(db, name, DefaultTaskOptions()); err != nil {
+		return err
+	}
+
+	results, err := readLegacyRows(db, legacy)
+	if err != nil {
+		return fmt.Errorf("读取旧版任务表 %s 失败: %w", legacy, err)
+	}
+	if err := saveResults(db, name, results); err != nil {
+		return err
+	}
+
+	// 每条写入的结果对应一条观测；无法写入的行只存在于旧表中
+	var written int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", ObservationTableName(name))).Scan(&written); err != nil {
+		return err
+	}
+	if written != len(results) {
+		log.Printf("[!] 旧版任务表 %s: 读取 %d 条记录，写入 %d 条，未能迁移的记录保留在 %s 中", name, len(results), written, legacy)
+		return nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("DROP TABLE %s", legacy)); err != nil {
+		return err
+	}
+	log.Printf("[*] 已迁移旧版任务表 %s: %d 条记录", name, len(results))
+	return nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// baselineTaskSQL 旧版本（拆表之前）创建的扁平任务表
+const baselineTaskSQL = `CREATE TABLE %s (
+    id INTEGER PRIMARY KEY AUTOINCREMENT, org_code TEXT, domain TEXT, host TEXT, protocol TEXT, url TEXT UNIQUE, ip TEXT, port INTEGER,
+    status_code INTEGER, length INTEGER, title TEXT, source TEXT, reliability INTEGER)`
+
+func TestMigrateLegacyTaskTables(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows       [][]interface{} // org_code, host, protocol, url, ip, port, title, source
+		assets     int
+		units      int
+		inventory  int
+		keepLegacy bool
+	}{
+		{
+			name: "全部记录写入新表后删除旧表并补录清单",
+			rows: [][]interface{}{
+				{"A", "a.example.com", "http", "http://a.example.com", "10.0.0.1", 80, "首页", "fofa"},
+				{"A;B", "b.example.com", "https", "https://b.example.com:443/", "10.0.0.2", 443, "登录", "quake"},
+				{"B", "10.0.0.3", "ssh", "ssh://10.0.0.3:22", "10.0.0.3", 22, "", "hunter"},
+			},
+			assets:    3,
+			units:     2,
+			inventory: 3,
+		},
+		{
+			name: "无法写入的记录使旧表保留",
+			rows: [][]interface{}{
+				{"A", "a.example.com", "http", "http://a.example.com", "10.0.0.1", 80, "首页", "fofa"},
+				{"B", "d.example.com", "ssh", "ssh://d.example.com:22", "", 22, "", "hunter"},
+			},
+			assets:     1,
+			units:      1,
+			inventory:  1,
+			keepLegacy: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "res.db")
+			legacy, err := sql.Open("sqlite", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			table := "task_20240101_00000001"
+			if _, err := legacy.Exec(fmt.Sprintf(baselineTaskSQL, table)); err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range tt.rows {
+				_, err := legacy.Exec(fmt.Sprintf("INSERT INTO %s (org_code, host, protocol, url, ip, port, title, source, reliability) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0)", table), r...)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			legacy.Close()
+
+			db, err := OpenDB(path)
+			if err != nil {
+				t.Fatalf("OpenDB: %v", err)
+			}
+			defer db.Close()
+
+			if version, err := SchemaVersion(db); err != nil || version != len(migrations) {
+				t.Errorf("SchemaVersion = %d, %v，应为 %d", version, err, len(migrations))
+			}
+			if typ, err := objectType(db, table); err != nil || typ != "view" {
+				t.Errorf("任务主名 %s 的类型 = %q, %v，应为兼容视图", table, typ, err)
+			}
+			if n := countRows(t, db, AssetTableName(table)); n != tt.assets {
+				t.Errorf("资产数 = %d, want %d", n, tt.assets)
+			}
+			if n := countRows(t, db, InventoryTable); n != tt.inventory {
+				t.Errorf("清单资产数 = %d, want %d", n, tt.inventory)
+			}
+			typ, err := objectType(db, table+"_legacy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kept := typ == "table"; kept != tt.keepLegacy {
+				t.Errorf("旧表保留 = %t, want %t", kept, tt.keepLegacy)
+			}
+			if n := countRows(t, db, UnitTableName(table)); n != tt.units {
+				t.Errorf("单位数 = %d, want %d", n, tt.units)
+			}
+		})
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db := openTestDB(t)
+	if version, err := SchemaVersion(db); err != nil || version != len(migrations) {
+		t.Fatalf("SchemaVersion = %d, %v，应为 %d", version, err, len(migrations))
+	}
+	// 再次执行不重复迁移
+	if err := migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if n := countRows(t, db, SchemaVersionTable); n != len(migrations) {
+		t.Errorf("迁移记录数 = %d, want %d", n, len(migrations))
+	}
+}
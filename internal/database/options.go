@@ -0,0 +1,117 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TaskOptionsTable 任务级存储选项表
+const TaskOptionsTable = "task_options"
+
+// 身份字段（url/host/domain/protocol）的合并方式
+const (
+	MergeFirst = "first" // 保留首个非空值
+	MergeUnion = "union" // 按发现顺序追加去重，以分号分隔
+)
+
+// TaskOptions 任务级存储选项：创建任务时写入，之后写入该任务的数据都按同一规则去重与合并
+type TaskOptions struct {
+	Identity  string            // 去重身份：url / host / ip_port
+	Merge     string            // 身份字段合并方式：first / union，留空时按身份自动选择
+	Fields    map[string]string // 字段 -> 合并策略，未配置的字段使用默认策略
+	Providers []string          // provider策略使用的平台优先级，靠前者优先
+}
+
+// DefaultTaskOptions 返回默认选项（按完整URL去重）
+func DefaultTaskOptions() TaskOptions {
+	opts, _ := TaskOptions{}.normalize()
+	return opts
+}
+
+// normalize 补齐缺省值并校验取值
+// 身份越粗，同一资产下聚合的URL/域名越多：url身份默认保留首个值，host、ip_port身份默认合并全部值
+func (o TaskOptions) normalize() (TaskOptions, error) {
+	switch o.Identity {
+	case "":
+		o.Identity = IdentityURL
+	case IdentityURL, IdentityHost, IdentityIPPort:
+	default:
+		return o, fmt.Errorf("不支持的去重身份: %s", o.Identity)
+	}
+
+	switch o.Merge {
+	case "":
+		if o.Identity == IdentityURL {
+			o.Merge = MergeFirst
+		} else {
+			o.Merge = MergeUnion
+		}
+	case MergeFirst, MergeUnion:
+	default:
+		return o, fmt.Errorf("不支持的合并方式: %s", o.Merge)
+	}
+
+	fields, err := normalizeFieldPolicies(o.Fields, o.Merge)
+	if err != nil {
+		return o, err
+	}
+	o.Fields = fields
+
+	if len(o.Providers) == 0 {
+		o.Providers = DefaultProviders
+	}
+	return o, nil
+}
+
+// createTaskOptionsSchema 创建任务选项表
+func createTaskOptionsSchema(db *sql.DB) error {
+	_, err := db.Exec(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    table_name TEXT PRIMARY KEY,
+    identity TEXT,
+    merge TEXT,
+    fields TEXT,
+    providers TEXT
+);`, TaskOptionsTable))
+	return err
+}
+
+// SaveTaskOptions 记录任务选项；任务已有选项时保持不变，避免同一任务内去重规则前后不一致
+func SaveTaskOptions(db Execer, tableName string, opts TaskOptions) error {
+	opts, err := opts.normalize()
+	if err != nil {
+		return err
+	}
+	fields, err := json.Marshal(opts.Fields)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("INSERT INTO %s (table_name, identity, merge, fields, providers) VALUES (?, ?, ?, ?, ?) ON CONFLICT(table_name) DO NOTHING", TaskOptionsTable),
+		tableName, opts.Identity, opts.Merge, string(fields), strings.Join(opts.Providers, ";"))
+	return err
+}
+
+// LoadTaskOptions 读取任务选项，未记录时返回默认选项
+func LoadTaskOptions(db Querier, tableName string) (TaskOptions, error) {
+	var opts TaskOptions
+	var fields, providers string
+	err := db.QueryRow(fmt.Sprintf("SELECT COALESCE(identity, ''), COALESCE(merge, ''), COALESCE(fields, ''), COALESCE(providers, '') FROM %s WHERE table_name = ?", TaskOptionsTable), tableName).
+		Scan(&opts.Identity, &opts.Merge, &fields, &providers)
+	if err == sql.ErrNoRows {
+		return DefaultTaskOptions(), nil
+	}
+	if err != nil {
+		return opts, err
+	}
+	if fields != "" {
+		if err := json.Unmarshal([]byte(fields), &opts.Fields); err != nil {
+			return opts, fmt.Errorf("解析字段合并策略失败: %w", err)
+		}
+	}
+	if providers != "" {
+		opts.Providers = strings.Split(providers, ";")
+	}
+	return opts.normalize()
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// QueriesTable 查询审计表：记录每一次发往测绘平台的分页请求，作为测绘范围的留档依据，也用于排查目标无结果的原因
+const QueriesTable = "queries"
+
+// QueryLog 一次分页请求的审计记录
+type QueryLog struct {
+	TableName  string // 所属任务表
+	Provider   string
+	Target     string
+	Query      string // 查询语法
+	Page       int
+	HTTPStatus int // 未收到响应时为0
+	Results    int
+	Credits    int
+	LatencyMS  int64
+	ErrorClass string // 成功时为空
+	Error      string
+	QueriedAt  string
+}
+
+// createQueriesSchema 创建查询审计表
+func createQueriesSchema(db *sql.DB) error {
+	statements := []string{
+		fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    %s,
+    table_name TEXT,
+    provider TEXT,
+    target TEXT,
+    query TEXT,
+    page INTEGER,
+    http_status INTEGER,
+    result_count INTEGER,
+    credits INTEGER,
+    latency_ms INTEGER,
+    error_class TEXT,
+    error TEXT,
+    queried_at TEXT
+);`, QueriesTable, DialectOf(db).serialKey()),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_table ON %s(table_name)", QueriesTable, QueriesTable),
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogQuery 写入一条查询审计记录
+func LogQuery(db Execer, entry QueryLog) error {
+	_, err := db.Exec(fmt.Sprintf(`
+INSERT INTO %s (table_name, provider, target, query, page, http_status, result_count, credits, latency_ms, error_class, error, queried_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, QueriesTable),
+		entry.TableName, entry.Provider, entry.Target, entry.Query, entry.Page, entry.HTTPStatus,
+		entry.Results, entry.Credits, entry.LatencyMS, entry.ErrorClass, entry.Error, entry.QueriedAt)
+	return err
+}
+
+// ReadQueryLogs 读取任务的查询审计记录，按写入顺序排列
+func ReadQueryLogs(db Querier, tableName string) ([]QueryLog, error) {
+	rows, err := db.Query(fmt.Sprintf(`SELECT COALESCE(provider, ''), COALESCE(target, ''), COALESCE(query, ''), COALESCE(page, 0),
+    COALESCE(http_status, 0), COALESCE(result_count, 0), COALESCE(credits, 0), COALESCE(latency_ms, 0), COALESCE(error_class, ''), COALESCE(error, ''),
+    COALESCE(queried_at, '')
+FROM %s
+WHERE table_name = ?
+ORDER BY id`, QueriesTable), tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []QueryLog
+	for rows.Next() {
+		entry := QueryLog{TableName: tableName}
+		err := rows.Scan(&entry.Provider, &entry.Target, &entry.Query, &entry.Page,
+			&entry.HTTPStatus, &entry.Results, &entry.Credits, &entry.LatencyMS, &entry.ErrorClass, &entry.Error,
+			&entry.QueriedAt)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, entry)
+	}
+	return logs, rows.Err()
+}
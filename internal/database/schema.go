@@ -0,0 +1,195 @@
+package database
+
+import (
+	"fmt"
+)
+
+// 资产类型：web资产按URL去重，非web服务按 ip:port 去重；
+// 待验证域名（被动收集、没有URL和端口的子域名）按域名去重，同主机的web资产入库后并入该资产
+const (
+	AssetKindWeb     = "web"
+	AssetKindService = "service"
+	AssetKindDomain  = "domain"
+)
+
+// AssetTableName 返回任务的资产表名（每个去重后的资产一行）
+func AssetTableName(tableName string) string {
+	return tableName + "_assets"
+}
+
+// ObservationTableName 返回任务的观测表名（每个平台的每次发现一行）
+func ObservationTableName(tableName string) string {
+	return tableName + "_observations"
+}
+
+// UnitTableName 返回任务的单位表名
+func UnitTableName(tableName string) string {
+	return tableName + "_units"
+}
+
+// AssetUnitTableName 返回任务的资产归属表名（资产、单位与归属依据一一对应）
+func AssetUnitTableName(tableName string) string {
+	return tableName + "_asset_units"
+}
+
+// ServiceTableName 返回任务对应的非web服务视图名（按 ip:port 去重）
+func ServiceTableName(tableName string) string {
+	return tableName + "_services"
+}
+
+// AssetIPSubquery 返回同时覆盖web资产与非web服务的 (ip, org_code) 子查询，供按IP统计使用
+// 多个单位共享的资产每个单位各占一行
+func AssetIPSubquery(tableName string) string {
+	return fmt.Sprintf("(SELECT a.ip AS ip, u.name AS org_code FROM %s a LEFT JOIN %s au ON au.asset_id = a.id LEFT JOIN %s u ON u.id = au.unit_id)",
+		AssetTableName(tableName), AssetUnitTableName(tableName), UnitTableName(tableName))
+}
+
+// createTaskSchema 创建任务的资产、观测、单位表，以及兼容旧版扁平表结构的视图
+func createTaskSchema(db Execer, tableName string) error {
+	d := DialectOf(db)
+	assets := AssetTableName(tableName)
+	observations := ObservationTableName(tableName)
+	units := UnitTableName(tableName)
+	assetUnits := AssetUnitTableName(tableName)
+
+	stmts := []string{
+		fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    %s,
+    name TEXT UNIQUE
+);`, units, d.serialKey()),
+
+		// 资产：去重后的当前值，各字段按合并策略取值；unit_id 为首个归属单位，org_code 为全部归属单位
+		fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    %s,
+    kind TEXT NOT NULL,
+    asset_key TEXT UNIQUE,
+    unit_id INTEGER REFERENCES %s(id),
+    org_code TEXT,
+    url TEXT,
+    domain TEXT,
+    host TEXT,
+    protocol TEXT,
+    transport TEXT,
+    ip TEXT,
+    port INTEGER,
+    status_code INTEGER,
+    length INTEGER,
+    title TEXT,
+    source TEXT,
+    reliability INTEGER,
+    server TEXT,
+    product TEXT,
+    os TEXT,
+    banner TEXT,
+    header TEXT,
+    cert_subject TEXT,
+    cert_san TEXT,
+    icp TEXT,
+    icp_company TEXT,
+    country TEXT,
+    province TEXT,
+    city TEXT,
+    asn TEXT,
+    org TEXT,
+    first_seen TEXT,
+    last_seen TEXT,
+    icon_hash TEXT,
+    ip_provider TEXT,
+    field_sources TEXT,
+    created_at TEXT,
+    updated_at TEXT
+);`, assets, d.serialKey(), units),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_ip ON %s(ip);`, assets, assets),
+
+		// 观测：每个平台的每次发现保留自己的标题、状态码、长度和时间
+		fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    %s,
+    asset_id INTEGER NOT NULL REFERENCES %s(id),
+    unit_id INTEGER REFERENCES %s(id),
+    source TEXT,
+    reliability INTEGER,
+    url TEXT,
+    domain TEXT,
+    host TEXT,
+    protocol TEXT,
+    transport TEXT,
+    ip TEXT,
+    port INTEGER,
+    status_code INTEGER,
+    length INTEGER,
+    title TEXT,
+    server TEXT,
+    product TEXT,
+    os TEXT,
+    banner TEXT,
+    header TEXT,
+    cert_subject TEXT,
+    cert_san TEXT,
+    icp TEXT,
+    icp_company TEXT,
+    country TEXT,
+    province TEXT,
+    city TEXT,
+    asn TEXT,
+    org TEXT,
+    first_seen TEXT,
+    last_seen TEXT,
+    icon_hash TEXT,
+    ip_provider TEXT,
+    observed_at TEXT
+);`, observations, d.serialKey(), assets, units),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_asset ON %s(asset_id);`, observations, observations),
+
+		// 资产归属：同一资产可归属多个单位，每条记录保留产生该归属的查询目标及其在目标文件中的序号
+		fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    asset_id INTEGER NOT NULL REFERENCES %s(id),
+    unit_id INTEGER NOT NULL REFERENCES %s(id),
+    target TEXT NOT NULL DEFAULT '',
+    target_row INTEGER,
+    source TEXT,
+    observed_at TEXT,
+    PRIMARY KEY (asset_id, unit_id, target)
+);`, assetUnits, assets, units),
+	}
+
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	for _, stmt := range taskViewStatements(d, tableName) {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return ensureSearchIndex(db, taskSearchIndex(tableName))
+}
+
+// taskViewStatements 返回任务兼容视图的建视图语句；视图定义变化时由迁移删除后重建
+func taskViewStatements(d Dialect, tableName string) []string {
+	assets := AssetTableName(tableName)
+	units := UnitTableName(tableName)
+
+	return []string{
+		// 兼容视图：任务表名保持旧版扁平结构，导出与分析逻辑无需感知底层拆表
+		fmt.Sprintf(`
+%s AS
+SELECT a.id, COALESCE(NULLIF(a.org_code, ''), u.name, '') AS org_code, a.domain, a.host, a.protocol, a.url, a.ip, a.port, a.status_code, a.length,
+    a.title, a.source, a.reliability, a.server, a.product, a.os, a.banner, a.header, a.cert_subject, a.cert_san,
+    a.icp, a.icp_company, a.country, a.province, a.city, a.asn, a.org, a.first_seen, a.last_seen, a.icon_hash, a.ip_provider, a.field_sources
+FROM %s a LEFT JOIN %s u ON u.id = a.unit_id
+WHERE a.kind = '%s';`, d.createView(tableName), assets, units, AssetKindWeb),
+		fmt.Sprintf(`
+%s AS
+SELECT a.id, COALESCE(NULLIF(a.org_code, ''), u.name, '') AS org_code, a.ip, a.port, a.transport, a.protocol AS service, a.host, a.domain, a.banner,
+    a.product, a.os, a.cert_subject, a.icp, a.icp_company, a.country, a.province, a.city, a.asn, a.org,
+    a.first_seen, a.last_seen, a.source, a.reliability, a.ip_provider, a.field_sources
+FROM %s a LEFT JOIN %s u ON u.id = a.unit_id
+WHERE a.kind = '%s';`, d.createView(ServiceTableName(tableName)), assets, units, AssetKindService),
+	}
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// SearchColumns 全文索引覆盖的资产字段
+var SearchColumns = []string{"title", "domain", "host", "server", "banner"}
+
+// searchIndex 一张内容表及其 FTS5 全文索引
+type searchIndex struct {
+	fts     string // 索引表名
+	content string // 内容表名（资产表或清单表），以 id 作为 rowid
+}
+
+// SearchIndexName 返回任务资产全文索引的表名
+func SearchIndexName(tableName string) string {
+	return tableName + "_fts"
+}
+
+// taskSearchIndex 任务资产的全文索引
+func taskSearchIndex(tableName string) searchIndex {
+	return searchIndex{fts: SearchIndexName(tableName), content: AssetTableName(tableName)}
+}
+
+// inventorySearchIndex 跨任务清单的全文索引
+func inventorySearchIndex() searchIndex {
+	return searchIndex{fts: InventoryTable + "_fts", content: InventoryTable}
+}
+
+// ensureSearchIndex 创建 FTS5 全文索引（trigram 分词，中文按字匹配），并以触发器随内容表同步；
+// 索引不存在时从内容表重建。PostgreSQL 不使用全文索引，搜索时直接匹配原表
+func ensureSearchIndex(db Execer, idx searchIndex) error {
+	if DialectOf(db) == DialectPostgres {
+		return nil
+	}
+	if t, err := objectType(db, idx.fts); err != nil || t != "" {
+		return err
+	}
+
+	cols := strings.Join(SearchColumns, ", ")
+	newCols := "new." + strings.Join(SearchColumns, ", new.")
+	oldCols := "old." + strings.Join(SearchColumns, ", old.")
+	changed := make([]string, len(SearchColumns))
+	for i, c := range SearchColumns {
+		changed[i] = fmt.Sprintf("old.%[1]s IS NOT new.%[1]s", c)
+	}
+
+	stmts := []string{
+		fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='id', tokenize='trigram')`, idx.fts, cols, idx.content),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ai AFTER INSERT ON %[2]s BEGIN
+    INSERT INTO %[1]s (rowid, %[3]s) VALUES (new.id, %[4]s);
+END`, idx.fts, idx.content, cols, newCols),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ad AFTER DELETE ON %[2]s BEGIN
+    INSERT INTO %[1]s (%[1]s, rowid, %[3]s) VALUES ('delete', old.id, %[4]s);
+END`, idx.fts, idx.content, cols, oldCols),
+		// 合并写入每次都会更新资产行，仅在索引字段变化时同步索引
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_au AFTER UPDATE ON %[2]s WHEN %[5]s BEGIN
+    INSERT INTO %[1]s (%[1]s, rowid, %[3]s) VALUES ('delete', old.id, %[4]s);
+    INSERT INTO %[1]s (rowid, %[3]s) VALUES (new.id, %[6]s);
+END`, idx.fts, idx.content, cols, oldCols, strings.Join(changed, " OR "), newCols),
+		fmt.Sprintf(`INSERT INTO %[1]s (%[1]s) VALUES ('rebuild')`, idx.fts),
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("创建全文索引 %s 失败: %w", idx.fts, err)
+		}
+	}
+	return nil
+}
+
+// SearchOptions 全文搜索条件
+type SearchOptions struct {
+	Terms          []string // 关键词，全部命中才返回；可写为 字段:关键词 只匹配该字段，如 title:登录
+	TableName      string   // 搜索的任务表，为空时搜索跨任务清单
+	Unit           string   // 单位代号
+	Source         string   // 数据来源平台
+	Port           int      // 端口，0 表示不限
+	MaxReliability int      // 可信度上限（0最可信），只返回数值不大于该值的资产，-1 表示不限
+	Limit          int      // 最多返回条数，0 表示不限
+}
+
+// SearchHit 一条搜索结果
+type SearchHit struct {
+	Task        string // 任务：搜索任务时为任务表名，搜索清单时为最近发现该资产的任务
+	OrgCode     string
+	Kind        string
+	URL         string
+	Host        string
+	IP          string
+	Port        int
+	Title       string
+	Server      string
+	Source      string
+	Reliability int
+	Status      string // 清单状态（active / missing），搜索任务时为空
+	LastSeen    string
+}
+
+// Search 在任务资产或跨任务清单中全文搜索
+// SQLite 使用 FTS5 trigram 索引：3个字及以上的关键词走 MATCH，更短的关键词（如“登录”）以 LIKE 在索引表上匹配；
+// PostgreSQL 不建全文索引，按不区分大小写的子串匹配原表
+func Search(db *sql.DB, opts SearchOptions) ([]SearchHit, error) {
+	if len(opts.Terms) == 0 {
+		return nil, fmt.Errorf("未指定关键词")
+	}
+	d := DialectOf(db)
+
+	var idx searchIndex
+	var taskExpr, statusExpr string
+	if opts.TableName == "" {
+		idx = inventorySearchIndex()
+		taskExpr, statusExpr = "COALESCE(a.last_task, '')", "COALESCE(a.status, '')"
+	} else {
+		idx = taskSearchIndex(opts.TableName)
+		taskExpr, statusExpr = sqlQuote(opts.TableName), "''"
+	}
+
+	from := fmt.Sprintf("%s a", idx.content)
+	if d != DialectPostgres {
+		from = fmt.Sprintf("%s f JOIN %s a ON a.id = f.rowid", idx.fts, idx.content)
+	}
+
+	var where []string
+	var args []interface{}
+	var match []string
+	for _, term := range opts.Terms {
+		column, text := splitSearchTerm(term)
+		if text == "" {
+			continue
+		}
+		columns := SearchColumns
+		if column != "" {
+			columns = []string{column}
+		}
+
+		// trigram 索引只能以 MATCH 匹配3个字及以上的关键词
+		if d != DialectPostgres && utf8.RuneCountInString(text) >= 3 {
+			phrase := `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+			if column != "" {
+				phrase = column + " : " + phrase
+			}
+			match = append(match, phrase)
+			continue
+		}
+
+		alias := "f"
+		if d == DialectPostgres {
+			alias = "a"
+		}
+		pattern := "%" + escapeLike(strings.ToLower(text)) + "%"
+		var ors []string
+		for _, c := range columns {
+			ors = append(ors, fmt.Sprintf(`LOWER(COALESCE(%s.%s, '')) LIKE ? ESCAPE '\'`, alias, c))
+			args = append(args, pattern)
+		}
+		where = append(where, "("+strings.Join(ors, " OR ")+")")
+	}
+	if len(match) == 0 && len(where) == 0 {
+		return nil, fmt.Errorf("未指定关键词")
+	}
+	if len(match) > 0 {
+		where = append([]string{fmt.Sprintf("%s MATCH ?", idx.fts)}, where...)
+		args = append([]interface{}{strings.Join(match, " AND ")}, args...)
+	}
+
+	if opts.Unit != "" {
+		where = append(where, d.Instr("';' || COALESCE(a.org_code, '') || ';'", "';' || ? || ';'")+" > 0")
+		args = append(args, opts.Unit)
+	}
+	if opts.Source != "" {
+		where = append(where, d.Instr("';' || COALESCE(a.source, '') || ';'", "';' || ? || ';'")+" > 0")
+		args = append(args, strings.ToLower(opts.Source))
+	}
+	if opts.Port > 0 {
+		where = append(where, "a.port = ?")
+		args = append(args, opts.Port)
+	}
+	if opts.MaxReliability >= 0 {
+		where = append(where, "a.reliability <= ?")
+		args = append(args, opts.MaxReliability)
+	}
+
+	query := fmt.Sprintf(`SELECT %s, COALESCE(a.org_code, ''), COALESCE(a.kind, ''), COALESCE(a.url, ''), COALESCE(a.host, ''), COALESCE(a.ip, ''),
+    COALESCE(a.port, 0), COALESCE(a.title, ''), COALESCE(a.server, ''), COALESCE(a.source, ''), COALESCE(a.reliability, 0),
+    %s, COALESCE(a.last_seen, '')
+FROM %s
+WHERE %s
+ORDER BY a.id`, taskExpr, statusExpr, from, strings.Join(where, " AND "))
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []SearchHit
+	for rows.Next() {
+		var h SearchHit
+		err := rows.Scan(&h.Task, &h.OrgCode, &h.Kind, &h.URL, &h.Host, &h.IP,
+			&h.Port, &h.Title, &h.Server, &h.Source, &h.Reliability, &h.Status, &h.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// splitSearchTerm 拆分 字段:关键词 形式的关键词，字段不在索引范围内时整体作为关键词
+func splitSearchTerm(term string) (string, string) {
+	term = strings.TrimSpace(term)
+	if i := strings.Index(term, ":"); i > 0 {
+		column := strings.ToLower(term[:i])
+		for _, c := range SearchColumns {
+			if c == column {
+				return column, strings.TrimSpace(term[i+1:])
+			}
+		}
+	}
+	return "", term
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
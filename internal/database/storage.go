@@ -0,0 +1,167 @@
+package database
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// 支持的存储后端
+const (
+	DriverSQLite   = "sqlite"   // 默认，本地 res.db
+	DriverPostgres = "postgres" // 多名分析人员共享同一数据库
+)
+
+// Querier 分析与导出模块发出只读查询所需的接口，*sql.DB 与 Storage 均满足
+// 查询统一使用 ? 占位符，PostgreSQL 后端在驱动层改写
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Execer 建表、迁移与写入所需的接口，*sql.DB 与事务（dbTx）均满足
+type Execer interface {
+	Querier
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Storage 结果存储：任务建表、去重入库、二轮查询所需的统计与跨任务清单
+type Storage interface {
+	Querier
+	Dialect() Dialect
+	// InitTask 创建任务表并记录任务选项，任务已存在时保持原有选项
+	InitTask(tableName string, opts TaskOptions) error
+	TaskExists(tableName string) (bool, error)
+	// LockTask 占用任务锁，同一任务同一时间只允许一个进程写入；被占用时返回 ErrTaskLocked
+	LockTask(tableName string) error
+	UnlockTask(tableName string) error
+	SaveResults(tableName string, results []model.QueryResult) error
+	GetExistingIPs(tableName string) (map[string]bool, error)
+	GetHighDensityCIDRs(tableName string, threshold int, opts CIDROptions) ([]string, error)
+	// UpdateInventory 将任务的资产合并进跨任务清单，markMissing 为 true 时标记本次任务覆盖的单位中消失的资产
+	UpdateInventory(tableName, taskID string, markMissing bool) (InventoryStats, error)
+	// SaveTaskRecord 写入任务元数据（配置快照、目标文件、平台结果数、错误、积分与输出文件）
+	SaveTaskRecord(rec TaskRecord) error
+	// LogQuery 写入一条测绘平台请求的审计记录
+	LogQuery(entry QueryLog) error
+	// ListTasks 列出全部任务及其行数与日期
+	ListTasks() ([]TaskSummary, error)
+	// RenameTask 设置任务的项目名称
+	RenameTask(tableName, name string) error
+	// DeleteTask 删除任务的全部表与元数据
+	DeleteTask(tableName string) error
+	// MergeTasks 将多个任务的结果按去重规则写入已创建的目标任务，返回写入的结果数
+	MergeTasks(target string, sources []string) (int, error)
+	// MergeDatabase 将外部 res.db 的任务与跨任务清单合并进本库，origin 记录来源文件
+	MergeDatabase(src *sql.DB, origin string) (DatabaseMergeStats, error)
+	// Search 在单个任务或跨任务清单中全文搜索资产
+	Search(opts SearchOptions) ([]SearchHit, error)
+	Close() error
+}
+
+// Open 按驱动名打开存储：sqlite 时 dsn 为数据库文件路径，postgres 时为连接串
+func Open(driver, dsn string) (Storage, error) {
+	var db *sql.DB
+	var err error
+	switch strings.ToLower(driver) {
+	case "", DriverSQLite:
+		db, err = OpenDB(dsn)
+	case DriverPostgres, "postgresql":
+		db, err = OpenPostgres(dsn)
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动: %s", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStorage{db: db}, nil
+}
+
+// sqlStorage 基于 database/sql 的存储，SQLite 与 PostgreSQL 共用，差异由连接的方言决定
+type sqlStorage struct {
+	db *sql.DB
+}
+
+func (s *sqlStorage) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.Query(query, args...)
+}
+
+func (s *sqlStorage) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRow(query, args...)
+}
+
+func (s *sqlStorage) Dialect() Dialect {
+	return DialectOf(s.db)
+}
+
+func (s *sqlStorage) InitTask(tableName string, opts TaskOptions) error {
+	if err := createTaskSchema(s.db, tableName); err != nil {
+		return err
+	}
+	return SaveTaskOptions(s.db, tableName, opts)
+}
+
+func (s *sqlStorage) TaskExists(tableName string) (bool, error) {
+	return TaskExists(s.db, tableName)
+}
+
+func (s *sqlStorage) LockTask(tableName string) error {
+	return LockTask(s.db, tableName)
+}
+
+func (s *sqlStorage) UnlockTask(tableName string) error {
+	return UnlockTask(s.db, tableName)
+}
+
+func (s *sqlStorage) SaveResults(tableName string, results []model.QueryResult) error {
+	return SaveResults(s.db, tableName, results)
+}
+
+func (s *sqlStorage) GetExistingIPs(tableName string) (map[string]bool, error) {
+	return GetExistingIPs(s.db, tableName)
+}
+
+func (s *sqlStorage) GetHighDensityCIDRs(tableName string, threshold int, opts CIDROptions) ([]string, error) {
+	return GetHighDensityCIDRs(s.db, tableName, threshold, opts)
+}
+
+func (s *sqlStorage) UpdateInventory(tableName, taskID string, markMissing bool) (InventoryStats, error) {
+	return UpdateInventory(s.db, tableName, taskID, markMissing)
+}
+
+func (s *sqlStorage) SaveTaskRecord(rec TaskRecord) error {
+	return SaveTaskRecord(s.db, rec)
+}
+
+func (s *sqlStorage) LogQuery(entry QueryLog) error {
+	return LogQuery(s.db, entry)
+}
+
+func (s *sqlStorage) ListTasks() ([]TaskSummary, error) {
+	return ListTasks(s.db)
+}
+
+func (s *sqlStorage) RenameTask(tableName, name string) error {
+	return SetTaskName(s.db, tableName, name)
+}
+
+func (s *sqlStorage) DeleteTask(tableName string) error {
+	return DeleteTask(s.db, tableName)
+}
+
+func (s *sqlStorage) MergeTasks(target string, sources []string) (int, error) {
+	return MergeTasks(s.db, target, sources)
+}
+
+func (s *sqlStorage) MergeDatabase(src *sql.DB, origin string) (DatabaseMergeStats, error) {
+	return MergeDatabase(s.db, src, origin)
+}
+
+func (s *sqlStorage) Search(opts SearchOptions) ([]SearchHit, error) {
+	return Search(s.db, opts)
+}
+
+func (s *sqlStorage) Close() error {
+	return s.db.Close()
+}
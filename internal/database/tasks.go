@@ -0,0 +1,166 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TasksTable 任务元数据表：每次运行一行，记录配置快照、目标文件、起止时间、平台、结果数、错误、积分消耗与输出文件
+const TasksTable = "tasks"
+
+// 任务运行状态
+const (
+	TaskStatusRunning   = "running"
+	TaskStatusCompleted = "completed"
+	TaskStatusFailed    = "failed"
+)
+
+// TaskError 任务运行中记录的一条错误
+type TaskError struct {
+	Time     string `json:"time"`
+	Stage    string `json:"stage"` // query / save / export 等
+	Provider string `json:"provider,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Message  string `json:"message"`
+}
+
+// TaskRecord 任务元数据，同时作为结果目录下 manifest.json 的内容
+type TaskRecord struct {
+	TaskID         string                 `json:"task_id"`
+	TableName      string                 `json:"table_name"`
+	Name           string                 `json:"name"` // 项目名称（可选），子命令中可代替任务ID
+	Status         string                 `json:"status"`
+	Owner          string                 `json:"owner"`
+	StartedAt      string                 `json:"started_at"`
+	FinishedAt     string                 `json:"finished_at"`
+	Config         map[string]interface{} `json:"config"` // 配置快照，API Key 等敏感项已脱敏
+	TargetFile     string                 `json:"target_file"`
+	TargetSHA256   string                 `json:"target_sha256"`
+	TargetRows     int                    `json:"target_rows"`
+	Providers      []string               `json:"providers"`       // 本次启用的平台
+	ProviderCounts map[string]int         `json:"provider_counts"` // 各平台返回的原始结果数（两轮合计）
+	Credits        map[string]int         `json:"credits"`         // 各平台消耗的积分
+	Errors         []TaskError            `json:"errors"`
+	ResultsDir     string                 `json:"results_dir"`
+	Outputs        []string               `json:"outputs"`
+	MergedFrom     []string               `json:"merged_from,omitempty"`   // 由 merge 合并生成时的来源任务表
+	ImportedFrom   string                 `json:"imported_from,omitempty"` // 由 mergedb 从其他 res.db 导入时的来源文件及其 SHA-256
+}
+
+// createTasksSchema 创建任务元数据表，JSON 字段以文本保存
+func createTasksSchema(db *sql.DB) error {
+	_, err := db.Exec(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    table_name TEXT PRIMARY KEY,
+    task_id TEXT,
+    name TEXT,
+    status TEXT,
+    owner TEXT,
+    started_at TEXT,
+    finished_at TEXT,
+    config TEXT,
+    target_file TEXT,
+    target_sha256 TEXT,
+    target_rows INTEGER,
+    providers TEXT,
+    provider_counts TEXT,
+    credits TEXT,
+    errors TEXT,
+    results_dir TEXT,
+    outputs TEXT,
+    merged_from TEXT,
+    imported_from TEXT
+);`, TasksTable))
+	return err
+}
+
+// SaveTaskRecord 写入或更新任务元数据；记录中未带项目名称时保留已设置的名称
+func SaveTaskRecord(db Execer, rec TaskRecord) error {
+	var jsonErr error
+	jsonText := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil && jsonErr == nil {
+			jsonErr = err
+		}
+		return string(data)
+	}
+	values := []interface{}{
+		rec.TableName, rec.TaskID, rec.Name, rec.Status, rec.Owner, rec.StartedAt, rec.FinishedAt,
+		jsonText(rec.Config), rec.TargetFile, rec.TargetSHA256, rec.TargetRows,
+		strings.Join(rec.Providers, ";"), jsonText(rec.ProviderCounts), jsonText(rec.Credits), jsonText(rec.Errors),
+		rec.ResultsDir, jsonText(rec.Outputs), strings.Join(rec.MergedFrom, ";"), rec.ImportedFrom,
+	}
+	if jsonErr != nil {
+		return jsonErr
+	}
+
+	_, err := db.Exec(fmt.Sprintf(`
+INSERT INTO %[1]s (table_name, task_id, name, status, owner, started_at, finished_at, config, target_file, target_sha256, target_rows,
+    providers, provider_counts, credits, errors, results_dir, outputs, merged_from, imported_from)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(table_name) DO UPDATE SET
+    task_id=excluded.task_id,
+    name=COALESCE(NULLIF(excluded.name, ''), %[1]s.name),
+    status=excluded.status,
+    owner=excluded.owner,
+    started_at=excluded.started_at,
+    finished_at=excluded.finished_at,
+    config=excluded.config,
+    target_file=excluded.target_file,
+    target_sha256=excluded.target_sha256,
+    target_rows=excluded.target_rows,
+    providers=excluded.providers,
+    provider_counts=excluded.provider_counts,
+    credits=excluded.credits,
+    errors=excluded.errors,
+    results_dir=excluded.results_dir,
+    outputs=excluded.outputs,
+    merged_from=excluded.merged_from,
+    imported_from=excluded.imported_from`, TasksTable), values...)
+	return err
+}
+
+// LoadTaskRecord 读取任务元数据，未记录时返回 nil（旧版本生成的任务没有元数据）
+func LoadTaskRecord(db Querier, tableName string) (*TaskRecord, error) {
+	rec := TaskRecord{TableName: tableName}
+	var config, providers, counts, credits, errs, outputs, mergedFrom string
+	err := db.QueryRow(fmt.Sprintf(`
+SELECT COALESCE(task_id, ''), COALESCE(name, ''), COALESCE(status, ''), COALESCE(owner, ''), COALESCE(started_at, ''), COALESCE(finished_at, ''),
+    COALESCE(config, ''), COALESCE(target_file, ''), COALESCE(target_sha256, ''), COALESCE(target_rows, 0),
+    COALESCE(providers, ''), COALESCE(provider_counts, ''), COALESCE(credits, ''), COALESCE(errors, ''), COALESCE(results_dir, ''), COALESCE(outputs, ''),
+    COALESCE(merged_from, ''), COALESCE(imported_from, '')
+FROM %s WHERE table_name = ?`, TasksTable), tableName).
+		Scan(&rec.TaskID, &rec.Name, &rec.Status, &rec.Owner, &rec.StartedAt, &rec.FinishedAt,
+			&config, &rec.TargetFile, &rec.TargetSHA256, &rec.TargetRows,
+			&providers, &counts, &credits, &errs, &rec.ResultsDir, &outputs, &mergedFrom, &rec.ImportedFrom)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if providers != "" {
+		rec.Providers = strings.Split(providers, ";")
+	}
+	if mergedFrom != "" {
+		rec.MergedFrom = strings.Split(mergedFrom, ";")
+	}
+	fields := []struct {
+		data string
+		dest interface{}
+	}{
+		{config, &rec.Config}, {counts, &rec.ProviderCounts}, {credits, &rec.Credits}, {errs, &rec.Errors}, {outputs, &rec.Outputs},
+	}
+	for _, f := range fields {
+		if f.data == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(f.data), f.dest); err != nil {
+			return nil, fmt.Errorf("解析任务元数据失败: %w", err)
+		}
+	}
+	return &rec, nil
+}
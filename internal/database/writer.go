@@ -0,0 +1,118 @@
+package database
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"log"
+	"sync"
+	"time"
+)
+
+// 写入器默认参数
+const (
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// ResultWriter 流式写入查询结果：各平台查询协程把结果送入通道，由单个写入协程按批次调用 SaveResults，
+// 每批一个事务。达到批次大小或到达刷新间隔即提交，进程中途退出时只丢失最后一个未提交的批次。
+type ResultWriter struct {
+	store         Storage
+	tableName     string
+	batchSize     int
+	flushInterval time.Duration
+
+	ch   chan []model.QueryResult
+	done chan struct{}
+
+	mu       sync.Mutex
+	received int
+	saved    int
+	err      error
+}
+
+// NewResultWriter 创建并启动写入器，batchSize、flushInterval 不大于0时使用默认值
+func NewResultWriter(store Storage, tableName string, batchSize int, flushInterval time.Duration) *ResultWriter {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+
+	w := &ResultWriter{
+		store:         store,
+		tableName:     tableName,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		ch:            make(chan []model.QueryResult, 64),
+		done:          make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write 提交一批查询结果，可被多个协程并发调用；Close 之后不得再调用
+func (w *ResultWriter) Write(results []model.QueryResult) {
+	if len(results) == 0 {
+		return
+	}
+	w.mu.Lock()
+	w.received += len(results)
+	w.mu.Unlock()
+	w.ch <- results
+}
+
+// Close 停止接收并写完剩余结果，返回已收到与已提交的结果数，以及写入过程中的首个错误
+func (w *ResultWriter) Close() (received, saved int, err error) {
+	close(w.ch)
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.received, w.saved, w.err
+}
+
+// run 写入协程：攒批并定时提交
+func (w *ResultWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	var batch []model.QueryResult
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := w.store.SaveResults(w.tableName, batch)
+
+		w.mu.Lock()
+		if err != nil {
+			log.Printf("[!] 批量写入 %d 条结果失败: %v", len(batch), err)
+			if w.err == nil {
+				w.err = err
+			}
+		} else {
+			w.saved += len(batch)
+		}
+		w.mu.Unlock()
+
+		batch = nil
+	}
+
+	for {
+		select {
+		case results, ok := <-w.ch:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, results...)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
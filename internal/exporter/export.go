@@ -1,14 +1,19 @@
 package exporter
 
 import (
-	"database/sql"
+	"cyberspace_mapping_summary/internal/database"
 	"encoding/csv"
 	"fmt"
 	"os"
+	"strings"
 )
 
-func ExportTableToCSV(db *sql.DB, tableName, outputPath string) error {
-	query := fmt.Sprintf("SELECT org_code, domain, host, protocol, url, ip, port, status_code, length, title, source, reliability FROM %s", tableName)
+func ExportTableToCSV(db database.Querier, tableName, outputPath string) error {
+	query := fmt.Sprintf(`SELECT org_code, domain, host, protocol, url, ip, port, status_code, length, title, source, reliability,
+    COALESCE(server, ''), COALESCE(product, ''), COALESCE(os, ''), COALESCE(banner, ''), COALESCE(header, ''), COALESCE(cert_subject, ''), COALESCE(cert_san, ''),
+    COALESCE(icp, ''), COALESCE(icp_company, ''), COALESCE(country, ''), COALESCE(province, ''), COALESCE(city, ''),
+    COALESCE(asn, ''), COALESCE(org, ''), COALESCE(ip_provider, ''), COALESCE(first_seen, ''), COALESCE(last_seen, ''), COALESCE(icon_hash, ''), COALESCE(field_sources, '')
+FROM %s`, tableName)
 	rows, err := db.Query(query)
 	if err != nil {
 		return err
@@ -30,13 +35,19 @@ func ExportTableToCSV(db *sql.DB, tableName, outputPath string) error {
 	// 写入表头
 	writer.Write([]string{
 		"OrgCode", "Domain", "Host", "Protocol", "URL", "IP", "Port", "StatusCode", "Length", "Title", "Source", "Reliability",
+		"Server", "Product", "OS", "Banner", "Header", "CertSubject", "CertSAN", "ICP", "ICPCompany",
+		"Country", "Province", "City", "ASN", "Org", "IPProvider", "FirstSeen", "LastSeen", "IconHash", "FieldSources",
 	})
 
 	for rows.Next() {
 		var org, domain, host, protocol, url, ip, title, source string
 		var port, status, length, reliability int
+		var server, product, osName, banner, header, certSubject, certSAN, icp, icpCompany string
+		var country, province, city, asn, asOrg, ipProvider, firstSeen, lastSeen, iconHash, fieldSources string
 
-		err := rows.Scan(&org, &domain, &host, &protocol, &url, &ip, &port, &status, &length, &title, &source, &reliability)
+		err := rows.Scan(&org, &domain, &host, &protocol, &url, &ip, &port, &status, &length, &title, &source, &reliability,
+			&server, &product, &osName, &banner, &header, &certSubject, &certSAN, &icp, &icpCompany,
+			&country, &province, &city, &asn, &asOrg, &ipProvider, &firstSeen, &lastSeen, &iconHash, &fieldSources)
 		if err != nil {
 			return err
 		}
@@ -54,6 +65,327 @@ func ExportTableToCSV(db *sql.DB, tableName, outputPath string) error {
 			title,
 			source,
 			fmt.Sprintf("%d", reliability),
+			server,
+			product,
+			osName,
+			banner,
+			header,
+			certSubject,
+			certSAN,
+			icp,
+			icpCompany,
+			country,
+			province,
+			city,
+			asn,
+			asOrg,
+			ipProvider,
+			firstSeen,
+			lastSeen,
+			iconHash,
+			fieldSources,
+		}
+		writer.Write(record)
+	}
+
+	return nil
+}
+
+// ExportServicesToCSV 导出非web服务表（SSH/Redis/MySQL等），与web资产分开存放
+func ExportServicesToCSV(db database.Querier, serviceTable, outputPath string) error {
+	query := fmt.Sprintf(`SELECT COALESCE(org_code, ''), ip, port, COALESCE(transport, ''), COALESCE(service, ''), COALESCE(host, ''), COALESCE(domain, ''),
+    COALESCE(banner, ''), COALESCE(product, ''), COALESCE(os, ''), COALESCE(cert_subject, ''), COALESCE(icp, ''), COALESCE(icp_company, ''), COALESCE(country, ''), COALESCE(province, ''), COALESCE(city, ''),
+    COALESCE(asn, ''), COALESCE(org, ''), COALESCE(ip_provider, ''), COALESCE(first_seen, ''), COALESCE(last_seen, ''), COALESCE(source, ''), reliability, COALESCE(field_sources, '')
+FROM %s ORDER BY ip, port`, serviceTable)
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 写入UTF-8 BOM，确保Excel等软件能正确识别中文
+	file.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// 写入表头
+	writer.Write([]string{
+		"OrgCode", "IP", "Port", "Transport", "Service", "Host", "Domain", "Banner", "Product", "OS", "CertSubject", "ICP", "ICPCompany",
+		"Country", "Province", "City", "ASN", "Org", "IPProvider", "FirstSeen", "LastSeen", "Source", "Reliability", "FieldSources",
+	})
+
+	for rows.Next() {
+		var org, ip, transport, service, host, domain, banner, product, osName, certSubject, icp, icpCompany string
+		var country, province, city, asn, asOrg, ipProvider, firstSeen, lastSeen, source, fieldSources string
+		var port, reliability int
+
+		err := rows.Scan(&org, &ip, &port, &transport, &service, &host, &domain, &banner, &product, &osName, &certSubject, &icp, &icpCompany,
+			&country, &province, &city, &asn, &asOrg, &ipProvider, &firstSeen, &lastSeen, &source, &reliability, &fieldSources)
+		if err != nil {
+			return err
+		}
+
+		record := []string{
+			org,
+			ip,
+			fmt.Sprintf("%d", port),
+			transport,
+			service,
+			host,
+			domain,
+			banner,
+			product,
+			osName,
+			certSubject,
+			icp,
+			icpCompany,
+			country,
+			province,
+			city,
+			asn,
+			asOrg,
+			ipProvider,
+			firstSeen,
+			lastSeen,
+			source,
+			fmt.Sprintf("%d", reliability),
+			fieldSources,
+		}
+		writer.Write(record)
+	}
+
+	return nil
+}
+
+// ExportInventoryToCSV 导出本次任务覆盖单位的跨任务资产清单，IsNew标记本次任务首次发现的资产
+func ExportInventoryToCSV(db database.Querier, unitTable, taskID, outputPath string) error {
+	query := fmt.Sprintf(`SELECT COALESCE(org_code, ''), COALESCE(kind, ''), COALESCE(url, ''), COALESCE(ip, ''), COALESCE(port, 0),
+    COALESCE(host, ''), COALESCE(domain, ''), COALESCE(protocol, ''), COALESCE(title, ''), COALESCE(status_code, 0), COALESCE(source, ''),
+    COALESCE(status, ''), COALESCE(first_seen, ''), COALESCE(last_seen, ''), COALESCE(first_task, ''), COALESCE(last_task, ''), COALESCE(seen_count, 0)
+FROM %s i
+WHERE EXISTS (SELECT 1 FROM %s u WHERE %s > 0)
+ORDER BY org_code, kind, asset_key`, database.InventoryTable, unitTable, database.DialectOf(db).Instr("';' || i.org_code || ';'", "';' || u.name || ';'"))
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 写入UTF-8 BOM，确保Excel等软件能正确识别中文
+	file.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// 写入表头
+	writer.Write([]string{
+		"OrgCode", "Kind", "URL", "IP", "Port", "Host", "Domain", "Protocol", "Title", "StatusCode", "Source",
+		"Status", "FirstSeen", "LastSeen", "FirstTask", "LastTask", "SeenCount", "IsNew",
+	})
+
+	for rows.Next() {
+		var org, kind, url, ip, host, domain, protocol, title, source string
+		var status, firstSeen, lastSeen, firstTask, lastTask string
+		var port, statusCode, seenCount int
+
+		err := rows.Scan(&org, &kind, &url, &ip, &port, &host, &domain, &protocol, &title, &statusCode, &source,
+			&status, &firstSeen, &lastSeen, &firstTask, &lastTask, &seenCount)
+		if err != nil {
+			return err
+		}
+
+		isNew := "0"
+		if firstTask == taskID {
+			isNew = "1"
+		}
+
+		record := []string{
+			org,
+			kind,
+			url,
+			ip,
+			fmt.Sprintf("%d", port),
+			host,
+			domain,
+			protocol,
+			title,
+			fmt.Sprintf("%d", statusCode),
+			source,
+			status,
+			firstSeen,
+			lastSeen,
+			firstTask,
+			lastTask,
+			fmt.Sprintf("%d", seenCount),
+			isNew,
+		}
+		writer.Write(record)
+	}
+
+	return nil
+}
+
+// ExportOwnershipToCSV 导出资产归属明细：每个 资产-单位-查询目标 一行，共享资产在每个单位下各出现一次
+func ExportOwnershipToCSV(db database.Querier, tableName, outputPath string) error {
+	query := fmt.Sprintf(`SELECT u.name, a.kind, a.asset_key, COALESCE(a.url, ''), COALESCE(a.ip, ''), COALESCE(a.port, 0),
+    COALESCE(au.target, ''), COALESCE(au.target_row, 0), COALESCE(au.source, ''),
+    (SELECT COUNT(DISTINCT x.unit_id) FROM %[1]s x WHERE x.asset_id = a.id)
+FROM %[1]s au
+JOIN %[2]s a ON a.id = au.asset_id
+JOIN %[3]s u ON u.id = au.unit_id
+ORDER BY u.name, a.kind, a.asset_key, au.target`,
+		database.AssetUnitTableName(tableName), database.AssetTableName(tableName), database.UnitTableName(tableName))
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 写入UTF-8 BOM，确保Excel等软件能正确识别中文
+	file.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// 写入表头
+	writer.Write([]string{
+		"OrgCode", "Kind", "AssetKey", "URL", "IP", "Port", "Target", "TargetRow", "Source", "UnitCount",
+	})
+
+	for rows.Next() {
+		var org, kind, key, url, ip, target, source string
+		var port, targetRow, unitCount int
+
+		err := rows.Scan(&org, &kind, &key, &url, &ip, &port, &target, &targetRow, &source, &unitCount)
+		if err != nil {
+			return err
+		}
+
+		record := []string{
+			org,
+			kind,
+			key,
+			url,
+			ip,
+			fmt.Sprintf("%d", port),
+			target,
+			fmt.Sprintf("%d", targetRow),
+			source,
+			fmt.Sprintf("%d", unitCount),
+		}
+		writer.Write(record)
+	}
+
+	return nil
+}
+
+// ExportQueriesToCSV 导出任务的查询审计记录：每次发往测绘平台的分页请求一行，作为测绘范围的留档依据
+func ExportQueriesToCSV(db database.Querier, tableName, outputPath string) error {
+	query := fmt.Sprintf(`SELECT COALESCE(queried_at, ''), COALESCE(provider, ''), COALESCE(target, ''), COALESCE(query, ''), COALESCE(page, 0),
+    COALESCE(http_status, 0), COALESCE(result_count, 0), COALESCE(credits, 0), COALESCE(latency_ms, 0), COALESCE(error_class, ''), COALESCE(error, '')
+FROM %s
+WHERE table_name = ?
+ORDER BY id`, database.QueriesTable)
+	rows, err := db.Query(query, tableName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 写入UTF-8 BOM，确保Excel等软件能正确识别中文
+	file.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// 写入表头
+	writer.Write([]string{
+		"Time", "Provider", "Target", "Query", "Page", "HTTPStatus", "Results", "Credits", "LatencyMS", "ErrorClass", "Error",
+	})
+
+	for rows.Next() {
+		var queriedAt, provider, target, querySyntax, errorClass, errorMessage string
+		var page, httpStatus, results, credits int
+		var latency int64
+
+		err := rows.Scan(&queriedAt, &provider, &target, &querySyntax, &page, &httpStatus, &results, &credits, &latency, &errorClass, &errorMessage)
+		if err != nil {
+			return err
+		}
+
+		record := []string{
+			queriedAt,
+			provider,
+			target,
+			querySyntax,
+			fmt.Sprintf("%d", page),
+			fmt.Sprintf("%d", httpStatus),
+			fmt.Sprintf("%d", results),
+			fmt.Sprintf("%d", credits),
+			fmt.Sprintf("%d", latency),
+			errorClass,
+			errorMessage,
+		}
+		writer.Write(record)
+	}
+
+	return nil
+}
+
+// ExportCIDRRollupToCSV 按 prefixes（IPv4）与 prefixesV6（IPv6）逐层汇总任务中的IP分布并导出，上层网段之后紧跟其包含的下层网段
+func ExportCIDRRollupToCSV(db database.Querier, tableName string, prefixes, prefixesV6 []int, outputPath string) error {
+	rollup, err := database.GetCIDRRollup(db, tableName, prefixes, prefixesV6)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 写入UTF-8 BOM，确保Excel等软件能正确识别中文
+	file.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// 写入表头
+	writer.Write([]string{"Prefix", "CIDR", "Parent", "IPs", "Units"})
+
+	for _, r := range rollup {
+		record := []string{
+			fmt.Sprintf("/%d", r.Prefix),
+			r.CIDR,
+			r.Parent,
+			fmt.Sprintf("%d", r.IPs),
+			strings.Join(r.Units, ";"),
 		}
 		writer.Write(record)
 	}
@@ -0,0 +1,16 @@
+package exporter
+
+import (
+	"cyberspace_mapping_summary/internal/database"
+	"encoding/json"
+	"os"
+)
+
+// ExportManifest 将任务元数据写入结果目录下的 manifest.json
+func ExportManifest(rec database.TaskRecord, outputPath string) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath, append(data, '\n'), 0644)
+}
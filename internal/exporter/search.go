@@ -0,0 +1,49 @@
+package exporter
+
+import (
+	"cyberspace_mapping_summary/internal/database"
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+// ExportSearchHits 导出 search 命令的搜索结果
+func ExportSearchHits(hits []database.SearchHit, outputPath string) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 写入UTF-8 BOM，确保Excel等软件能正确识别中文
+	file.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// 写入表头
+	writer.Write([]string{
+		"Task", "OrgCode", "Kind", "URL", "Host", "IP", "Port", "Title", "Server", "Source", "Reliability", "Status", "LastSeen",
+	})
+
+	for _, h := range hits {
+		record := []string{
+			h.Task,
+			h.OrgCode,
+			h.Kind,
+			h.URL,
+			h.Host,
+			h.IP,
+			fmt.Sprintf("%d", h.Port),
+			h.Title,
+			h.Server,
+			h.Source,
+			fmt.Sprintf("%d", h.Reliability),
+			h.Status,
+			h.LastSeen,
+		}
+		writer.Write(record)
+	}
+
+	return nil
+}
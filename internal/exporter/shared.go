@@ -0,0 +1,51 @@
+package exporter
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+// ExportSharedResultsToCSV 导出第二轮在CDN/云共享网段中新发现、未记入单位资产的结果，
+// cidrProviders 为查询网段 -> 网段所属厂商
+func ExportSharedResultsToCSV(results []model.QueryResult, cidrProviders map[string]string, outputPath string) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 写入UTF-8 BOM，确保Excel等软件能正确识别中文
+	file.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// 写入表头
+	writer.Write([]string{
+		"OrgCode", "Target", "CIDRProvider", "IPProvider", "URL", "Host", "IP", "Port", "Protocol", "Title", "Server", "ASN", "Org", "Source",
+	})
+
+	for _, r := range results {
+		record := []string{
+			r.Unit,
+			r.Target,
+			cidrProviders[r.Target],
+			r.IPProvider,
+			r.URL,
+			r.Host,
+			r.IP,
+			fmt.Sprintf("%d", r.Port),
+			r.Protocol,
+			r.Title,
+			r.Server,
+			r.ASN,
+			r.Org,
+			r.Source,
+		}
+		writer.Write(record)
+	}
+
+	return nil
+}
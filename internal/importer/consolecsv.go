@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"bufio"
+	"cyberspace_mapping_summary/internal/model"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// consoleColumns 测绘平台网页端导出CSV的表头别名（FOFA 为英文字段名，Hunter 为中文列名），按小写匹配
+var consoleColumns = map[string][]string{
+	"url":         {"url", "link", "网址", "链接", "url地址"},
+	"host":        {"host", "主机", "主机名"},
+	"ip":          {"ip", "ip地址"},
+	"port":        {"port", "端口"},
+	"protocol":    {"protocol", "协议", "服务", "应用协议"},
+	"transport":   {"base_protocol", "传输层协议", "传输协议"},
+	"title":       {"title", "标题", "网站标题", "网页标题"},
+	"domain":      {"domain", "域名"},
+	"status_code": {"status_code", "状态码", "网站状态码"},
+	"server":      {"server"},
+	"banner":      {"banner"},
+	"product":     {"product", "组件", "应用/组件", "产品"},
+	"os":          {"os", "操作系统"},
+	"cert":        {"cert", "certs_subject_cn", "证书", "证书主体"},
+	"icp":         {"icp", "备案号", "icp备案号"},
+	"icp_company": {"备案单位", "备案主体", "icp备案企业", "备案企业"},
+	"country":     {"country_name", "country", "国家"},
+	"province":    {"region", "province", "省份"},
+	"city":        {"city", "城市"},
+	"asn":         {"as_number", "asn"},
+	"org":         {"as_organization", "as组织"},
+	"last_seen":   {"lastupdatetime", "更新时间", "探测时间", "最后更新时间"},
+	"icon_hash":   {"icon_hash", "favicon"},
+}
+
+// parseConsoleCSV 解析 FOFA / Hunter 网页端导出的CSV，按表头识别列，列的顺序与多少不限
+func parseConsoleCSV(r io.Reader, source string) ([]model.QueryResult, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for field, aliases := range consoleColumns {
+			if _, ok := columns[field]; ok {
+				continue
+			}
+			for _, alias := range aliases {
+				if name == alias {
+					columns[field] = i
+				}
+			}
+		}
+	}
+	_, hasURL := columns["url"]
+	_, hasHost := columns["host"]
+	_, hasIP := columns["ip"]
+	if !hasURL && !hasHost && !hasIP {
+		return nil, fmt.Errorf("未识别的表头，需要包含 url、host 或 ip 列: %s", strings.Join(header, ","))
+	}
+
+	var results []model.QueryResult
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		rawURL, host, ip := get("url"), get("host"), get("ip")
+		port := atoi(get("port"))
+		protocol := strings.ToLower(get("protocol"))
+
+		// FOFA 的 host 列对web资产为 协议://主机:端口（http 时省略协议），对其他服务为 主机:端口
+		if rawURL == "" && strings.Contains(host, "://") {
+			rawURL = host
+		}
+		if u := parseURL(rawURL); u != nil {
+			if protocol == "" || protocol == "http" || protocol == "https" {
+				protocol = strings.ToLower(u.Scheme)
+			}
+			host = strings.ToLower(u.Hostname())
+			if port == 0 {
+				port = atoi(u.Port())
+			}
+		} else {
+			host = strings.ToLower(hostOnly(host))
+		}
+		if host == "" {
+			host = ip
+		}
+		if host == "" {
+			continue
+		}
+		if ip == "" && isIP(host) {
+			ip = host
+		}
+		if port == 0 && protocol == "https" {
+			port = 443
+		} else if port == 0 && (protocol == "http" || protocol == "") {
+			port = 80
+		}
+
+		// 协议为空按web处理，由端口推断http/https；非web服务不构造URL
+		url := ""
+		if protocol == "" || protocol == "http" || protocol == "https" {
+			if rawURL != "" && strings.Contains(rawURL, "://") {
+				url = rawURL
+			} else {
+				url = webURL(protocol, host, port)
+			}
+			if protocol == "" {
+				protocol = strings.SplitN(url, "://", 2)[0]
+			}
+		}
+
+		domain := get("domain")
+		if domain == "" {
+			domain = domainOf(host)
+		}
+
+		results = append(results, model.QueryResult{
+			Domain:      domain,
+			Host:        host,
+			Protocol:    protocol,
+			URL:         url,
+			IP:          ip,
+			Port:        port,
+			StatusCode:  atoi(get("status_code")),
+			Title:       get("title"),
+			Source:      source,
+			Reliability: ReliabilityVerified,
+			Transport:   get("transport"),
+			Server:      get("server"),
+			Product:     joinList(strings.FieldsFunc(get("product"), func(r rune) bool { return r == ',' || r == ';' || r == '，' })),
+			OS:          get("os"),
+			Banner:      get("banner"),
+			CertSubject: get("cert"),
+			ICP:         get("icp"),
+			ICPCompany:  get("icp_company"),
+			Country:     get("country"),
+			Province:    get("province"),
+			City:        get("city"),
+			ASN:         get("asn"),
+			Org:         get("org"),
+			LastSeen:    normalizeTime(get("last_seen")),
+			IconHash:    get("icon_hash"),
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"bufio"
+	"cyberspace_mapping_summary/internal/model"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// httpxRecord httpx -json 输出的一行（不同版本中 port、content_length 可能为字符串或数字）
+type httpxRecord struct {
+	Timestamp     string      `json:"timestamp"`
+	URL           string      `json:"url"`
+	Input         string      `json:"input"`
+	Host          string      `json:"host"` // 解析出的IP
+	Port          interface{} `json:"port"`
+	Scheme        string      `json:"scheme"`
+	Title         string      `json:"title"`
+	Webserver     string      `json:"webserver"`
+	StatusCode    interface{} `json:"status_code"`
+	ContentLength interface{} `json:"content_length"`
+	Tech          []string    `json:"tech"`
+	A             []string    `json:"a"`
+	Favicon       string      `json:"favicon"`
+	Failed        bool        `json:"failed"`
+	TLS           struct {
+		SubjectCN  string   `json:"subject_cn"`
+		SubjectOrg []string `json:"subject_org"`
+		SubjectAN  []string `json:"subject_an"`
+	} `json:"tls"`
+}
+
+// parseHttpx 解析 httpx -json 输出，探测失败的记录跳过
+func parseHttpx(r io.Reader) ([]model.QueryResult, error) {
+	var results []model.QueryResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var item httpxRecord
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			return nil, err
+		}
+		if item.Failed || item.URL == "" {
+			continue
+		}
+
+		u, err := url.Parse(item.URL)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		scheme := strings.ToLower(u.Scheme)
+		if item.Scheme != "" {
+			scheme = strings.ToLower(item.Scheme)
+		}
+		port := atoi(item.Port)
+		if port == 0 {
+			port = atoi(u.Port())
+		}
+		if port == 0 && scheme == "https" {
+			port = 443
+		} else if port == 0 {
+			port = 80
+		}
+
+		ip := ""
+		if isIP(item.Host) {
+			ip = item.Host
+		} else if len(item.A) > 0 {
+			ip = item.A[0]
+		} else if isIP(host) {
+			ip = host
+		}
+
+		var certParts []string
+		if item.TLS.SubjectCN != "" {
+			certParts = append(certParts, "CN="+item.TLS.SubjectCN)
+		}
+		if len(item.TLS.SubjectOrg) > 0 {
+			certParts = append(certParts, "O="+item.TLS.SubjectOrg[0])
+		}
+
+		results = append(results, model.QueryResult{
+			Target:      item.Input,
+			Domain:      domainOf(host),
+			Host:        host,
+			Protocol:    scheme,
+			URL:         item.URL,
+			IP:          ip,
+			Port:        port,
+			StatusCode:  atoi(item.StatusCode),
+			Length:      atoi(item.ContentLength),
+			Title:       item.Title,
+			Source:      FormatHttpx,
+			Reliability: ReliabilityVerified,
+			Transport:   "tcp",
+			Server:      item.Webserver,
+			Product:     joinList(item.Tech),
+			CertSubject: strings.Join(certParts, ", "),
+			CertSAN:     joinList(item.TLS.SubjectAN),
+			LastSeen:    normalizeTime(item.Timestamp),
+			IconHash:    item.Favicon,
+		})
+	}
+	return results, scanner.Err()
+}
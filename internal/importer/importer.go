@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/util"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持导入的外部工具输出格式
+const (
+	FormatSubfinder = "subfinder"  // subfinder 文本（每行一个子域名）或 -oJ JSONL
+	FormatAmass     = "amass"      // amass 文本（含 v4 的 FQDN --> IPAddress 关系行）或 v3 -json
+	FormatHttpx     = "httpx"      // httpx -json JSONL
+	FormatNmap      = "nmap"       // nmap -oX XML
+	FormatMasscan   = "masscan"    // masscan -oJ JSON
+	FormatFOFACSV   = "fofa_csv"   // FOFA 网页端导出的CSV
+	FormatHunterCSV = "hunter_csv" // Hunter 网页端导出的CSV
+)
+
+// Formats 全部导入格式，用于命令行提示
+var Formats = []string{FormatSubfinder, FormatAmass, FormatHttpx, FormatNmap, FormatMasscan, FormatFOFACSV, FormatHunterCSV}
+
+// 导入结果的可信度，数值越小越可信，与测绘结果合并时取更可信者
+const (
+	ReliabilityVerified = 0 // 主动探测确认的服务（httpx、nmap）与测绘平台网页端导出的数据
+	ReliabilityPortOnly = 1 // 只确认端口开放、未识别服务（masscan）
+	ReliabilityPassive  = 2 // 被动收集的子域名，未确认存活（subfinder、amass）
+)
+
+// parser 将一种格式的文件内容转换为标准化结果，Source 与可信度由各格式自行填写
+type parser func(r io.Reader) ([]model.QueryResult, error)
+
+var parsers = map[string]parser{
+	FormatSubfinder: parseSubfinder,
+	FormatAmass:     parseAmass,
+	FormatHttpx:     parseHttpx,
+	FormatNmap:      parseNmap,
+	FormatMasscan:   parseMasscan,
+	FormatFOFACSV:   func(r io.Reader) ([]model.QueryResult, error) { return parseConsoleCSV(r, FormatFOFACSV) },
+	FormatHunterCSV: func(r io.Reader) ([]model.QueryResult, error) { return parseConsoleCSV(r, FormatHunterCSV) },
+}
+
+// ImportFile 读取外部工具的输出文件并转换为标准化结果，全部归属 unit（多个单位以分号分隔）
+// 记录中带有查询输入（如 subfinder 的根域名、httpx 的 input）时以其作为归属依据，否则为文件名
+func ImportFile(format, path, unit string) ([]model.QueryResult, error) {
+	parse, ok := parsers[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("不支持的导入格式: %s（可选: %s）", format, strings.Join(Formats, " / "))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	results, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	for i := range results {
+		results[i].Unit = unit
+		if results[i].Target == "" {
+			results[i].Target = filepath.Base(path)
+		}
+	}
+	return results, nil
+}
+
+// webURL 由协议、主机与端口构造URL，省略默认端口，IPv6地址加方括号
+func webURL(scheme, host string, port int) string {
+	if host == "" {
+		return ""
+	}
+	if scheme == "" {
+		scheme = "http"
+		if port == 443 {
+			scheme = "https"
+		}
+	}
+	host = util.URLHost(host)
+	if port == 0 || (scheme == "http" && port == 80) || (scheme == "https" && port == 443) {
+		return scheme + "://" + host
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, host, port)
+}
+
+// parseURL 解析带协议的URL，不是URL时返回 nil
+func parseURL(raw string) *url.URL {
+	if !strings.Contains(raw, "://") {
+		return nil
+	}
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	return u
+}
+
+// hostOnly 去除 主机:端口 中的端口
+func hostOnly(hostPort string) string {
+	if host, _, err := net.SplitHostPort(hostPort); err == nil {
+		return host
+	}
+	return strings.Trim(hostPort, "[]")
+}
+
+// isIP 判断是否为IP地址
+func isIP(s string) bool {
+	return net.ParseIP(s) != nil
+}
+
+// domainOf 主机名不是IP时作为域名
+func domainOf(host string) string {
+	if host == "" || isIP(host) {
+		return ""
+	}
+	return host
+}
+
+// atoi 解析数字，兼容以字符串或数字给出的端口、状态码
+func atoi(value interface{}) int {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// timeLayouts 各工具输出的时间格式
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// normalizeTime 将时间统一为 2006-01-02 15:04:05 格式，支持Unix时间戳，无法解析时原样返回
+func normalizeTime(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil && sec > 0 {
+		return time.Unix(sec, 0).Format("2006-01-02 15:04:05")
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02 15:04:05")
+		}
+	}
+	return value
+}
+
+// joinList 去除空白项并去重后以分号连接，保持原有顺序
+func joinList(items []string) string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		result = append(result, item)
+	}
+	return strings.Join(result, ";")
+}
@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportFile(t *testing.T) {
+	scanned := time.Unix(1753495200, 0).Format("2006-01-02 15:04:05")
+
+	tests := []struct {
+		format string
+		file   string
+		want   []model.QueryResult
+	}{
+		{FormatSubfinder, "subfinder.txt", []model.QueryResult{
+			{Unit: "A", Target: "subfinder.txt", Domain: "www.example.com", Host: "www.example.com", Source: "subfinder", Reliability: ReliabilityPassive},
+			{Unit: "A", Target: "subfinder.txt", Domain: "api.example.com", Host: "api.example.com", IP: "10.0.0.2", Source: "subfinder", Reliability: ReliabilityPassive},
+		}},
+		{FormatSubfinder, "subfinder.jsonl", []model.QueryResult{
+			{Unit: "A", Target: "example.com", Domain: "mail.example.com", Host: "mail.example.com", IP: "10.0.0.3", Source: "subfinder", Reliability: ReliabilityPassive},
+		}},
+		{FormatAmass, "amass.txt", []model.QueryResult{
+			{Unit: "A", Target: "amass.txt", Domain: "www.example.com", Host: "www.example.com", IP: "10.0.0.1", Source: "amass", Reliability: ReliabilityPassive},
+			{Unit: "A", Target: "amass.txt", Domain: "vpn.example.com", Host: "vpn.example.com", Source: "amass", Reliability: ReliabilityPassive},
+		}},
+		{FormatHttpx, "httpx.jsonl", []model.QueryResult{
+			{Unit: "A", Target: "www.example.com", Domain: "www.example.com", Host: "www.example.com", Protocol: "https", URL: "https://www.example.com",
+				IP: "10.0.0.1", Port: 443, StatusCode: 200, Length: 512, Title: "首页", Source: "httpx", Reliability: ReliabilityVerified, Transport: "tcp",
+				Server: "nginx", Product: "Nginx;jQuery", CertSubject: "CN=www.example.com, O=Example", CertSAN: "www.example.com;example.com",
+				LastSeen: "2025-07-26 10:00:00"},
+		}},
+		{FormatNmap, "nmap.xml", []model.QueryResult{
+			{Unit: "A", Target: "www.example.com", Domain: "www.example.com", Host: "www.example.com", Protocol: "ssh", IP: "10.0.0.1", Port: 22,
+				Source: "nmap", Reliability: ReliabilityVerified, Transport: "tcp", Product: "OpenSSH", Banner: "OpenSSH 8.9p1", LastSeen: scanned},
+			{Unit: "A", Target: "www.example.com", Domain: "www.example.com", Host: "www.example.com", Protocol: "https", URL: "https://www.example.com:8443",
+				IP: "10.0.0.1", Port: 8443, Source: "nmap", Reliability: ReliabilityVerified, Transport: "tcp", Server: "nginx", Product: "nginx", Banner: "nginx",
+				LastSeen: scanned},
+		}},
+		{FormatMasscan, "masscan.json", []model.QueryResult{
+			{Unit: "A", Target: "10.0.0.5", Host: "10.0.0.5", Protocol: "redis", IP: "10.0.0.5", Port: 6379, Source: "masscan", Reliability: ReliabilityPortOnly,
+				Transport: "tcp", Banner: "redis_version:6.2", LastSeen: scanned},
+		}},
+		{FormatFOFACSV, "fofa.csv", []model.QueryResult{
+			{Unit: "A", Target: "fofa.csv", Domain: "example.com", Host: "www.example.com", Protocol: "https", URL: "https://www.example.com", IP: "10.0.0.1",
+				Port: 443, Title: "首页", Source: "fofa_csv", Reliability: ReliabilityVerified},
+			{Unit: "A", Target: "fofa.csv", Host: "10.0.0.1", Protocol: "ssh", IP: "10.0.0.1", Port: 22, Source: "fofa_csv", Reliability: ReliabilityVerified},
+		}},
+		{FormatHunterCSV, "hunter.csv", []model.QueryResult{
+			{Unit: "A", Target: "hunter.csv", Domain: "example.com", Host: "oa.example.com", Protocol: "http", URL: "http://oa.example.com:8080", IP: "10.0.0.8",
+				Port: 8080, StatusCode: 200, Title: "OA系统", Source: "hunter_csv", Reliability: ReliabilityVerified},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := ImportFile(tt.format, filepath.Join("testdata", tt.file), "A")
+			if err != nil {
+				t.Fatalf("ImportFile(%s) error: %v", tt.file, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ImportFile(%s) returned %d results, want %d: %+v", tt.file, len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("result %d:\n got  %+v\n want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestImportFileUnknownFormat(t *testing.T) {
+	if _, err := ImportFile("burp", filepath.Join("testdata", "httpx.jsonl"), "A"); err == nil {
+		t.Fatal("ImportFile with an unknown format returned no error")
+	}
+}
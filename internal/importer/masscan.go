@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"bufio"
+	"cyberspace_mapping_summary/internal/model"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// masscanRecord masscan -oJ 输出的一条记录
+type masscanRecord struct {
+	IP        string      `json:"ip"`
+	Timestamp interface{} `json:"timestamp"`
+	Ports     []struct {
+		Port    int    `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		Service struct {
+			Name   string `json:"name"`
+			Banner string `json:"banner"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+// parseMasscan 解析 masscan -oJ 输出：每个开放端口一条非web服务结果
+// masscan 的JSON数组常以多余的逗号结尾，无法整体解析，按行读取每个对象
+func parseMasscan(r io.Reader) ([]model.QueryResult, error) {
+	type portKey struct {
+		ip    string
+		port  int
+		proto string
+	}
+	var results []model.QueryResult
+	index := make(map[portKey]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ",")
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var item masscanRecord
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			return nil, err
+		}
+		if item.IP == "" {
+			continue // 结尾的 {"finished": 1}
+		}
+
+		lastSeen := normalizeTime(textOf(item.Timestamp))
+		for _, p := range item.Ports {
+			if p.Status != "" && p.Status != "open" {
+				continue
+			}
+			// 开启 --banners 时同一端口的banner另起一条记录，合并到端口结果上
+			key := portKey{item.IP, p.Port, p.Proto}
+			if i, ok := index[key]; ok {
+				if p.Service.Name != "" {
+					results[i].Protocol = p.Service.Name
+				}
+				results[i].Banner = joinList([]string{results[i].Banner, p.Service.Banner})
+				continue
+			}
+			index[key] = len(results)
+			results = append(results, model.QueryResult{
+				Target:      item.IP,
+				Host:        item.IP,
+				Protocol:    p.Service.Name,
+				IP:          item.IP,
+				Port:        p.Port,
+				Source:      FormatMasscan,
+				Reliability: ReliabilityPortOnly,
+				Transport:   p.Proto,
+				Banner:      p.Service.Banner,
+				LastSeen:    lastSeen,
+			})
+		}
+	}
+	return results, scanner.Err()
+}
+
+// textOf 将以字符串或数字给出的时间戳转为字符串
+func textOf(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return time.Unix(int64(v), 0).Format("2006-01-02 15:04:05")
+	}
+	return ""
+}
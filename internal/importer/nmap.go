@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"cyberspace_mapping_summary/internal/model"
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+// nmapRun nmap -oX 输出中用到的部分
+type nmapRun struct {
+	Hosts []struct {
+		EndTime int64 `xml:"endtime,attr"`
+		Status  struct {
+			State string `xml:"state,attr"`
+		} `xml:"status"`
+		Addresses []struct {
+			Addr     string `xml:"addr,attr"`
+			AddrType string `xml:"addrtype,attr"`
+		} `xml:"address"`
+		Hostnames []struct {
+			Name string `xml:"name,attr"`
+			Type string `xml:"type,attr"` // user（扫描时指定）/ PTR（反向解析）
+		} `xml:"hostnames>hostname"`
+		Ports []struct {
+			Protocol string `xml:"protocol,attr"`
+			PortID   int    `xml:"portid,attr"`
+			State    struct {
+				State string `xml:"state,attr"`
+			} `xml:"state"`
+			Service struct {
+				Name      string `xml:"name,attr"`
+				Product   string `xml:"product,attr"`
+				Version   string `xml:"version,attr"`
+				ExtraInfo string `xml:"extrainfo,attr"`
+				OSType    string `xml:"ostype,attr"`
+				Tunnel    string `xml:"tunnel,attr"`
+			} `xml:"service"`
+			Scripts []struct {
+				ID     string `xml:"id,attr"`
+				Output string `xml:"output,attr"`
+			} `xml:"script"`
+		} `xml:"ports>port"`
+		OSMatches []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"os>osmatch"`
+	} `xml:"host"`
+}
+
+// nmapWebServices nmap 识别为web服务的服务名及其协议
+var nmapWebServices = map[string]string{
+	"http":       "http",
+	"http-alt":   "http",
+	"http-proxy": "http",
+	"https":      "https",
+	"https-alt":  "https",
+	"ssl/http":   "https",
+}
+
+// parseNmap 解析 nmap -oX 输出：每个开放端口一条结果，http/https 服务作为web资产，其余作为非web服务
+func parseNmap(r io.Reader) ([]model.QueryResult, error) {
+	var run nmapRun
+	if err := xml.NewDecoder(r).Decode(&run); err != nil {
+		return nil, err
+	}
+
+	var results []model.QueryResult
+	for _, h := range run.Hosts {
+		if h.Status.State != "" && h.Status.State != "up" {
+			continue
+		}
+		ip := ""
+		for _, a := range h.Addresses {
+			if a.AddrType == "ipv4" || a.AddrType == "ipv6" {
+				ip = a.Addr
+				break
+			}
+		}
+		if ip == "" {
+			continue
+		}
+		// 扫描时指定的域名优先，其次为反向解析结果
+		hostname := ""
+		for _, n := range h.Hostnames {
+			if n.Type == "user" || hostname == "" {
+				hostname = strings.ToLower(n.Name)
+			}
+		}
+		host := ip
+		if hostname != "" {
+			host = hostname
+		}
+		osName := ""
+		if len(h.OSMatches) > 0 {
+			osName = h.OSMatches[0].Name
+		}
+		lastSeen := ""
+		if h.EndTime > 0 {
+			lastSeen = time.Unix(h.EndTime, 0).Format("2006-01-02 15:04:05")
+		}
+
+		for _, p := range h.Ports {
+			if p.State.State != "open" {
+				continue
+			}
+			svc := p.Service
+			scripts := make(map[string]string)
+			for _, s := range p.Scripts {
+				scripts[s.ID] = strings.TrimSpace(s.Output)
+			}
+
+			result := model.QueryResult{
+				Target:      hostname,
+				Domain:      domainOf(hostname),
+				Host:        host,
+				Protocol:    svc.Name,
+				IP:          ip,
+				Port:        p.PortID,
+				Source:      FormatNmap,
+				Reliability: ReliabilityVerified,
+				Transport:   p.Protocol,
+				Product:     svc.Product,
+				OS:          joinList([]string{svc.OSType, osName}),
+				Banner:      strings.Join(strings.Fields(strings.Join([]string{svc.Product, svc.Version, svc.ExtraInfo}, " ")), " "),
+				LastSeen:    lastSeen,
+			}
+			if result.Target == "" {
+				result.Target = ip
+			}
+
+			// http 服务经 SSL 隧道时为 https
+			scheme := nmapWebServices[svc.Name]
+			if scheme == "http" && svc.Tunnel == "ssl" {
+				scheme = "https"
+			}
+			if scheme != "" {
+				result.Protocol = scheme
+				result.URL = webURL(scheme, host, p.PortID)
+				result.Server = scripts["http-server-header"]
+				if title := scripts["http-title"]; !strings.HasPrefix(title, "Site doesn't have a title") {
+					result.Title = title
+				}
+			}
+			if cert := scripts["ssl-cert"]; cert != "" {
+				result.CertSubject = strings.TrimPrefix(strings.SplitN(cert, "\n", 2)[0], "Subject: ")
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
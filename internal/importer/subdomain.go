@@ -0,0 +1,141 @@
+package importer
+
+import (
+	"bufio"
+	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/util"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// amassRelation 匹配 amass v4 文本输出中的解析关系，如 www.example.com (FQDN) --> a_record --> 1.2.3.4 (IPAddress)
+var amassRelation = regexp.MustCompile(`^(\S+) \(FQDN\) --> (\S+) --> (\S+) \((\w+)\)`)
+
+// subdomain 被动收集到的一个子域名
+type subdomain struct {
+	host  string
+	ips   []string
+	input string // 收集时指定的根域名
+}
+
+// parseSubfinder 解析 subfinder 输出：每行一个子域名，或 -oJ 输出的 {"host","input","source"} JSONL
+func parseSubfinder(r io.Reader) ([]model.QueryResult, error) {
+	var hosts []subdomain
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			var item struct {
+				Host  string `json:"host"`
+				Input string `json:"input"`
+				IP    string `json:"ip"`
+			}
+			if err := json.Unmarshal([]byte(line), &item); err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, subdomain{host: item.Host, input: item.Input, ips: []string{item.IP}})
+			continue
+		}
+		// 带 -oI 时为 host,ip,source
+		fields := strings.Split(line, ",")
+		s := subdomain{host: fields[0]}
+		if len(fields) > 1 {
+			s.ips = []string{fields[1]}
+		}
+		hosts = append(hosts, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return subdomainResults(hosts, FormatSubfinder), nil
+}
+
+// parseAmass 解析 amass 输出：每行一个子域名、v4 的 FQDN --> IPAddress 关系行，或 v3 -json 的 {"name","domain","addresses"} JSONL
+func parseAmass(r io.Reader) ([]model.QueryResult, error) {
+	var hosts []subdomain
+	index := make(map[string]int)
+	add := func(s subdomain) {
+		s.host = strings.ToLower(strings.TrimSuffix(s.host, "."))
+		if i, ok := index[s.host]; ok {
+			hosts[i].ips = append(hosts[i].ips, s.ips...)
+			return
+		}
+		index[s.host] = len(hosts)
+		hosts = append(hosts, s)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			var item struct {
+				Name      string `json:"name"`
+				Domain    string `json:"domain"`
+				Addresses []struct {
+					IP string `json:"ip"`
+				} `json:"addresses"`
+			}
+			if err := json.Unmarshal([]byte(line), &item); err != nil {
+				return nil, err
+			}
+			s := subdomain{host: item.Name, input: item.Domain}
+			for _, a := range item.Addresses {
+				s.ips = append(s.ips, a.IP)
+			}
+			add(s)
+			continue
+		}
+		if m := amassRelation.FindStringSubmatch(line); m != nil {
+			// 只取解析记录，CNAME、NS 等关系只保留左侧的域名
+			if m[4] == "IPAddress" {
+				add(subdomain{host: m[1], ips: []string{m[3]}})
+			} else {
+				add(subdomain{host: m[1]})
+			}
+			continue
+		}
+		add(subdomain{host: strings.Fields(line)[0]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return subdomainResults(hosts, FormatAmass), nil
+}
+
+// subdomainResults 子域名转为待验证域名：被动收集不能确认服务存活，只记录域名（及解析到的IP），不带URL和端口，
+// 可信度最低；测绘或 httpx 等确认了同主机的web资产后并入该资产
+func subdomainResults(hosts []subdomain, source string) []model.QueryResult {
+	var results []model.QueryResult
+	for _, s := range hosts {
+		host := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s.host), "."))
+		if !util.IsValidHost(host) || isIP(host) {
+			continue
+		}
+		ip := ""
+		for _, candidate := range s.ips {
+			if isIP(strings.TrimSpace(candidate)) {
+				ip = strings.TrimSpace(candidate)
+				break
+			}
+		}
+		results = append(results, model.QueryResult{
+			Target:      s.input,
+			Domain:      host,
+			Host:        host,
+			IP:          ip,
+			Source:      source,
+			Reliability: ReliabilityPassive,
+		})
+	}
+	return results
+}
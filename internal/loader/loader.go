@@ -10,6 +10,7 @@ import (
 	"golang.org/x/text/transform"
 
 	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/util"
 )
 
 func ReadTargetsFromCSV(path string) ([]model.TargetEntry, error) {
@@ -66,6 +67,7 @@ func ReadTargetsFromCSV(path string) ([]model.TargetEntry, error) {
 
 	var results []model.TargetEntry
 
+	row := 0
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
@@ -74,6 +76,7 @@ func ReadTargetsFromCSV(path string) ([]model.TargetEntry, error) {
 		if err != nil {
 			return nil, err
 		}
+		row++
 
 		if len(record) < 2 {
 			continue // 跳过非法行
@@ -85,13 +88,14 @@ func ReadTargetsFromCSV(path string) ([]model.TargetEntry, error) {
 		// 将多行（回车换行）域名拆开
 		hosts := strings.Split(rawHosts, "\n")
 		for _, h := range hosts {
-			h = strings.TrimSpace(h)
+			h = util.NormalizeHost(h) // IPv6 字面量可带方括号书写，如 [2001:db8::1]
 			if h == "" {
 				continue
 			}
 			results = append(results, model.TargetEntry{
 				Unit: org,
 				Host: h,
+				Row:  row,
 			})
 		}
 	}
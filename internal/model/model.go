@@ -1,14 +1,19 @@
 package model
 
+import "strings"
+
 // TargetEntry 表示 loader.csv 里的一行：单位代号 + 域名/IP
 type TargetEntry struct {
-	Unit string // 单位代号
+	Unit string // 单位代号，多个单位共享的目标以分号分隔
 	Host string // 域名或 IP
+	Row  int    // 目标文件中的记录序号（从1开始），第二轮C段目标为0
 }
 
 // QueryResult 是所有空间测绘平台标准化后的结果结构
 type QueryResult struct {
-	Unit        string // 所属单位代号
+	Unit        string // 所属单位代号，多个单位以分号分隔
+	Target      string // 产生该结果的查询目标（域名/IP/C段），作为单位归属依据
+	TargetRow   int    // 查询目标在目标文件中的记录序号，第二轮C段目标为0
 	Domain      string // 域名（不包含IP）
 	Host        string // 主机名或IP地址
 	Protocol    string // 协议（http/https）
@@ -20,4 +25,31 @@ type QueryResult struct {
 	Title       string // 页面标题
 	Source      string // 数据来源平台，例如 quake/fofa/hunter
 	Reliability int    // 可信度 0/1/2
+	Transport   string // 传输层协议（tcp/udp），非web服务使用
+
+	// 服务、网络与指纹信息（平台未返回时为空）
+	Server      string // Server响应头
+	Product     string // 产品/组件，多个以分号分隔
+	OS          string // 操作系统
+	Banner      string // 服务banner
+	Header      string // HTTP响应头
+	CertSubject string // 证书主体（CN/O）
+	CertSAN     string // 证书SAN域名，多个以分号分隔
+	ICP         string // ICP备案号
+	ICPCompany  string // ICP备案主体（单位名称）
+	Country     string // 国家
+	Province    string // 省份
+	City        string // 城市
+	ASN         string // 自治系统号
+	Org         string // 自治系统所属组织
+	FirstSeen   string // 首次发现时间（2006-01-02 15:04:05）；各平台不提供，入库时取该条记录的更新时间，资产合并后为各次观测中最早者
+	LastSeen    string // 平台最后更新时间（2006-01-02 15:04:05）
+	IconHash    string // favicon哈希
+	IPProvider  string // IP所属的CDN或云厂商（按本地网段库匹配），如 cdn:cloudflare、cloud:aliyun
+}
+
+// IsWeb 判断是否为web资产：URL为http/https的结果进入URL表，其余作为非web服务单独入库
+func (r QueryResult) IsWeb() bool {
+	url := strings.ToLower(strings.TrimSpace(r.URL))
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
 }
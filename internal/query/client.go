@@ -0,0 +1,171 @@
+package query
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 各平台默认接口地址
+const (
+	DefaultFofaBaseURL   = "https://fofa.info/api/v1/search/all"
+	DefaultHunterBaseURL = "https://hunter.qianxin.com/openApi/search"
+	DefaultQuakeBaseURL  = "https://quake.360.net/api/v3/scroll/quake_service"
+)
+
+// defaultTimeout 未配置超时时使用的默认值
+const defaultTimeout = 30 * time.Second
+
+// ProviderOptions 测绘平台请求定制项，用于私有化部署或本地替身服务
+type ProviderOptions struct {
+	BaseURL            string            // 接口地址，留空使用官方地址
+	UserAgent          string            // 自定义User-Agent，留空使用Go默认值
+	Headers            map[string]string // 额外请求头
+	Timeout            time.Duration     // 单次请求超时，0表示使用默认值
+	InsecureSkipVerify bool              // 跳过TLS证书校验（自签名证书的私有化部署）
+	CAFile             string            // 额外信任的CA证书文件（PEM）
+	ServerName         string            // TLS SNI / 证书校验使用的主机名
+	OnPage             func(PageStat)    // 每次分页请求结束（成功或失败）后的回调（可为空），用于审计与统计积分消耗
+}
+
+// 请求失败的错误分类
+const (
+	ErrClassRequest = "request"     // 构造请求失败
+	ErrClassTimeout = "timeout"     // 请求超时
+	ErrClassNetwork = "network"     // 连接失败、读取响应失败等
+	ErrClassHTTP    = "http_status" // HTTP状态码异常且响应无法解析
+	ErrClassDecode  = "decode"      // 响应不是预期的JSON
+	ErrClassAPI     = "api"         // 平台返回业务错误（Key无效、积分不足、语法错误等）
+)
+
+// PageStat 单页请求的统计
+type PageStat struct {
+	Provider   string
+	Target     string
+	Query      string // 查询语法
+	Page       int
+	HTTPStatus int // 未收到响应时为0
+	Results    int
+	Credits    int // 本页消耗的积分
+	Latency    time.Duration
+	ErrorClass string // 成功时为空
+	Error      string
+	Time       time.Time // 请求发出时间
+}
+
+// pageTrace 记录单页请求的耗时与结果，请求结束时上报
+type pageTrace struct {
+	opts ProviderOptions
+	stat PageStat
+}
+
+// startPage 开始记录一次分页请求
+func (o ProviderOptions) startPage(provider, target, querySyntax string, page int) *pageTrace {
+	return &pageTrace{
+		opts: o,
+		stat: PageStat{Provider: provider, Target: target, Query: querySyntax, Page: page, Time: time.Now()},
+	}
+}
+
+// status 记录HTTP状态码
+func (t *pageTrace) status(code int) {
+	t.stat.HTTPStatus = code
+}
+
+// done 上报成功的请求
+func (t *pageTrace) done(results, credits int) {
+	t.stat.Results = results
+	t.stat.Credits = credits
+	t.report()
+}
+
+// fail 上报失败的请求并原样返回错误；响应无法解析且状态码异常时归为 http_status
+func (t *pageTrace) fail(class string, err error) error {
+	if class == ErrClassDecode && t.stat.HTTPStatus >= 400 {
+		class = ErrClassHTTP
+	}
+	t.stat.ErrorClass = class
+	t.stat.Error = err.Error()
+	t.report()
+	return err
+}
+
+func (t *pageTrace) report() {
+	t.stat.Latency = time.Since(t.stat.Time)
+	if t.opts.OnPage != nil {
+		t.opts.OnPage(t.stat)
+	}
+}
+
+// networkErrorClass 区分超时与其他网络错误
+func networkErrorClass(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrClassTimeout
+	}
+	return ErrClassNetwork
+}
+
+// endpoint 返回实际使用的接口地址
+func (o ProviderOptions) endpoint(defaultURL string) string {
+	if o.BaseURL != "" {
+		return o.BaseURL
+	}
+	return defaultURL
+}
+
+// newHTTPClient 根据配置构造HTTP客户端
+func (o ProviderOptions) newHTTPClient() (*http.Client, error) {
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	client := &http.Client{Timeout: timeout}
+
+	// 未做任何TLS定制时沿用默认Transport
+	if !o.InsecureSkipVerify && o.CAFile == "" && o.ServerName == "" {
+		return client, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		ServerName:         o.ServerName,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file failed: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in ca file: %s", o.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client.Transport = transport
+
+	return client, nil
+}
+
+// applyHeaders 为请求设置User-Agent和额外请求头
+func (o ProviderOptions) applyHeaders(req *http.Request) {
+	if o.UserAgent != "" {
+		req.Header.Set("User-Agent", o.UserAgent)
+	}
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/util"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -10,24 +11,68 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"time"
 )
 
-// FofaConfig 用于配置API Key
+// DefaultFofaFields 默认请求的FOFA字段，均为不需要会员权限的基础字段；
+// banner、header、product、lastupdatetime、icon_hash 等需要对应会员权限，由配置按需追加
+const DefaultFofaFields = "host,ip,port,protocol,title,server,domain,certs_subject_cn,certs_subject_org,icp,country_name,region,city,as_number,as_organization,base_protocol"
+
+// fofaRequiredFields 构造URL必需的字段，无论配置如何都会请求
+var fofaRequiredFields = []string{"host", "ip", "port", "protocol"}
+
+// FofaConfig 用于配置API Key及请求定制项
 type FofaConfig struct {
 	APIKey string
+	Fields string // 请求字段列表（逗号分隔），留空使用DefaultFofaFields
+	ProviderOptions
 }
 
 // FofaAPIResponse 定义API返回结构
 type FofaAPIResponse struct {
-	Error           bool                     `json:"error"`
-	ConsumedFpoint  int                      `json:"consumed_fpoint"`
-	RequiredFpoints int                      `json:"required_fpoints"`
-	Size            int                      `json:"size"`
-	Page            int                      `json:"page"`
-	Mode            string                   `json:"mode"`
-	Query           string                   `json:"query"`
-	Results         []map[string]interface{} `json:"results"` // results是对象数组
+	Error           bool          `json:"error"`
+	ConsumedFpoint  int           `json:"consumed_fpoint"`
+	RequiredFpoints int           `json:"required_fpoints"`
+	Size            int           `json:"size"`
+	Page            int           `json:"page"`
+	Mode            string        `json:"mode"`
+	Query           string        `json:"query"`
+	Results         []interface{} `json:"results"` // 对象数组，或与fields顺序一致的数组
+}
+
+// fofaFieldList 解析字段配置，补齐必需字段并去重
+func fofaFieldList(fields string) []string {
+	if strings.TrimSpace(fields) == "" {
+		fields = DefaultFofaFields
+	}
+
+	seen := make(map[string]bool)
+	var list []string
+	for _, f := range append(append([]string{}, fofaRequiredFields...), strings.Split(fields, ",")...) {
+		f = strings.TrimSpace(f)
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		list = append(list, f)
+	}
+	return list
+}
+
+// fofaItemToMap 将单条结果统一为字段名到值的映射
+func fofaItemToMap(item interface{}, fields []string) map[string]interface{} {
+	switch v := item.(type) {
+	case map[string]interface{}:
+		return v
+	case []interface{}:
+		m := make(map[string]interface{}, len(fields))
+		for i, f := range fields {
+			if i < len(v) {
+				m[f] = v[i]
+			}
+		}
+		return m
+	}
+	return map[string]interface{}{}
 }
 
 // buildFofaQuery 构造FOFA查询参数
@@ -65,7 +110,7 @@ func buildFofaQuery(target, apiKey string, page, size int, fields string) url.Va
 }
 
 // QueryFofa 单域名或IP查询接口，返回结果列表或错误
-func QueryFofa(target, apiKey string) ([]model.QueryResult, error) {
+func QueryFofa(target string, cfg FofaConfig) ([]model.QueryResult, error) {
 	// 构造查询语法用于日志显示
 	var querySyntax string
 	if isCIDR(target) {
@@ -80,62 +125,69 @@ func QueryFofa(target, apiKey string) ([]model.QueryResult, error) {
 
 	// 使用重试机制执行查询
 	return retryWithBackoff("FOFA", target, func() ([]model.QueryResult, error) {
-		return queryFofaInternal(target, apiKey)
+		return queryFofaInternal(target, querySyntax, cfg)
 	})
 }
 
 // queryFofaInternal FOFA查询的内部实现
-func queryFofaInternal(target, apiKey string) ([]model.QueryResult, error) {
+func queryFofaInternal(target, querySyntax string, cfg FofaConfig) ([]model.QueryResult, error) {
 	var allResults []model.QueryResult
-	client := &http.Client{Timeout: 30 * time.Second}
+	client, err := cfg.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("http client creation failed: %w", err)
+	}
 
-	// 默认字段：host,ip,port,protocol,title,server,domain
-	fields := "host,ip,port,protocol,title,server,domain"
+	fieldList := fofaFieldList(cfg.Fields)
+	fields := strings.Join(fieldList, ",")
 	page := 1
 	size := 1000 // FOFA默认每页1000条
 
 	for {
-		params := buildFofaQuery(target, apiKey, page, size, fields)
+		trace := cfg.startPage("fofa", target, querySyntax, page)
+		params := buildFofaQuery(target, cfg.APIKey, page, size, fields)
 
 		// 构造请求URL
-		baseURL := "https://fofa.info/api/v1/search/all"
+		baseURL := cfg.endpoint(DefaultFofaBaseURL)
 		reqURL := baseURL + "?" + params.Encode()
 
 		req, err := http.NewRequest("GET", reqURL, nil)
 		if err != nil {
-			return nil, fmt.Errorf("request creation failed: %w", err)
+			return nil, trace.fail(ErrClassRequest, fmt.Errorf("request creation failed: %w", err))
 		}
+		cfg.applyHeaders(req)
 
 		resp, err := client.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("http request failed: %w", err)
+			return nil, trace.fail(networkErrorClass(err), fmt.Errorf("http request failed: %w", err))
 		}
+		trace.status(resp.StatusCode)
 
 		respBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
-			return nil, fmt.Errorf("read response failed: %w", err)
+			return nil, trace.fail(networkErrorClass(err), fmt.Errorf("read response failed: %w", err))
 		}
 
 		var fofaResp FofaAPIResponse
 		if err := json.Unmarshal(respBody, &fofaResp); err != nil {
-			return nil, fmt.Errorf("json unmarshal failed: %w", err)
+			return nil, trace.fail(ErrClassDecode, fmt.Errorf("json unmarshal failed: %w", err))
 		}
 
 		// 检查API错误
 		if fofaResp.Error {
-			return nil, fmt.Errorf("FOFA API error: %s", string(respBody))
+			return nil, trace.fail(ErrClassAPI, fmt.Errorf("FOFA API error: %s", string(respBody)))
 		}
 
 		// 转换结果
 		pageResults := 0
 		for _, result := range fofaResp.Results {
-			queryResult := convertFofaItemToResult("", result)
+			queryResult := convertFofaItemToResult("", fofaItemToMap(result, fieldList))
 			allResults = append(allResults, queryResult)
 			pageResults++
 		}
 
 		fmt.Printf("[FOFA] 第%d页扫描完成: %s -> 获得%d条结果\n", page, target, pageResults)
+		trace.done(pageResults, fofaResp.ConsumedFpoint)
 
 		// 检查是否还有更多数据
 		if len(fofaResp.Results) < size {
@@ -158,11 +210,12 @@ func queryFofaInternal(target, apiKey string) ([]model.QueryResult, error) {
 func convertFofaItemToResult(unit string, item map[string]interface{}) model.QueryResult {
 	// 从map中提取字段
 	rawHost := stringFromAny(item["host"])
-	ip := stringFromAny(item["ip"])
+	ip := util.CanonicalIP(stringFromAny(item["ip"]))
 	port := intFromAny(item["port"])
 	protocol := stringFromAny(item["protocol"])
 	title := strings.TrimSpace(strings.Trim(stringFromAny(item["title"]), "\n"))
 	domain := stringFromAny(item["domain"])
+	header := stringFromAny(item["header"])
 
 	// 处理host字段：提取域名部分，但保留端口号信息
 	host, hostPort := extractHostAndPort(rawHost)
@@ -187,11 +240,27 @@ func convertFofaItemToResult(unit string, item map[string]interface{}) model.Que
 	if hostPort > 0 {
 		finalPort = hostPort
 	}
-	url := constructFofaURL(host, ip, finalPort, protocol)
+	// 非web服务不构造URL，作为服务单独入库
+	url := ""
+	if isWebProtocol(protocol) {
+		url = constructFofaURL(host, ip, finalPort, protocol)
+	}
 
-	// 获取HTTP状态码和长度（FOFA API不直接提供，设为0）
-	statusCode := 0
-	length := 0
+	// FOFA不直接提供状态码和长度，从响应头的状态行和Content-Length中解析
+	statusCode := intFromAny(item["status_code"])
+	if statusCode == 0 {
+		statusCode = statusCodeFromHeader(header)
+	}
+	length := contentLengthFromHeader(header)
+
+	// 证书主体：CN与O拼接
+	var certParts []string
+	if cn := stringFromAny(item["certs_subject_cn"]); cn != "" {
+		certParts = append(certParts, "CN="+cn)
+	}
+	if o := stringFromAny(item["certs_subject_org"]); o != "" {
+		certParts = append(certParts, "O="+o)
+	}
 
 	return model.QueryResult{
 		Unit:        unit,
@@ -206,6 +275,20 @@ func convertFofaItemToResult(unit string, item map[string]interface{}) model.Que
 		Title:       title,
 		Source:      "fofa",
 		Reliability: 0,
+		Transport:   stringFromAny(item["base_protocol"]),
+		Server:      stringFromAny(item["server"]),
+		Product:     joinList(strings.Split(stringFromAny(item["product"]), ",")),
+		Banner:      stringFromAny(item["banner"]),
+		Header:      header,
+		CertSubject: strings.Join(certParts, ", "),
+		ICP:         stringFromAny(item["icp"]),
+		Country:     stringFromAny(item["country_name"]),
+		Province:    stringFromAny(item["region"]),
+		City:        stringFromAny(item["city"]),
+		ASN:         textFromAny(item["as_number"]),
+		Org:         stringFromAny(item["as_organization"]),
+		LastSeen:    normalizeTime(stringFromAny(item["lastupdatetime"])),
+		IconHash:    textFromAny(item["icon_hash"]),
 	}
 }
 
@@ -215,11 +298,12 @@ func constructFofaURL(host, ip string, port int, protocol string) string {
 		return ""
 	}
 
-	// 确定使用host还是ip
+	// 确定使用host还是ip，IPv6 字面量加方括号
 	targetHost := host
 	if targetHost == "" {
 		targetHost = ip
 	}
+	targetHost = util.URLHost(targetHost)
 
 	// 处理协议
 	if protocol == "" {
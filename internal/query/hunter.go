@@ -2,20 +2,22 @@ package query
 
 import (
 	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/util"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
-	"time"
 )
 
-// HunterConfig 用于配置API Key
+// HunterConfig 用于配置API Key及请求定制项
 type HunterConfig struct {
 	APIKey string
+	ProviderOptions
 }
 
 // HunterAPIResponse 定义API返回结构
@@ -23,11 +25,22 @@ type HunterAPIResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Data    struct {
-		Total int                      `json:"total"`
-		Arr   []map[string]interface{} `json:"arr"`
+		Total        int                      `json:"total"`
+		Arr          []map[string]interface{} `json:"arr"`
+		ConsumeQuota string                   `json:"consume_quota"` // 如“消耗积分：100”
+		RestQuota    string                   `json:"rest_quota"`    // 如“今日剩余积分：400”
 	} `json:"data"`
 }
 
+// quotaNumberPattern 提取积分描述中的数字
+var quotaNumberPattern = regexp.MustCompile(`\d+`)
+
+// parseHunterQuota 解析Hunter积分描述中的数值，无法解析时为0
+func parseHunterQuota(s string) int {
+	n, _ := strconv.Atoi(quotaNumberPattern.FindString(s))
+	return n
+}
+
 // buildHunterQuery 构造Hunter查询参数
 func buildHunterQuery(target, apiKey string, page, pageSize int) url.Values {
 	// 判断查询类型
@@ -61,7 +74,7 @@ func buildHunterQuery(target, apiKey string, page, pageSize int) url.Values {
 }
 
 // QueryHunter 单域名或IP查询接口，返回结果列表或错误
-func QueryHunter(target, apiKey string) ([]model.QueryResult, error) {
+func QueryHunter(target string, cfg HunterConfig) ([]model.QueryResult, error) {
 	// 构造查询语法用于日志显示
 	var querySyntax string
 	if isCIDR(target) {
@@ -76,49 +89,55 @@ func QueryHunter(target, apiKey string) ([]model.QueryResult, error) {
 
 	// 使用重试机制执行查询
 	return retryWithBackoff("Hunter", target, func() ([]model.QueryResult, error) {
-		return queryHunterInternal(target, apiKey)
+		return queryHunterInternal(target, querySyntax, cfg)
 	})
 }
 
 // queryHunterInternal Hunter查询的内部实现
-func queryHunterInternal(target, apiKey string) ([]model.QueryResult, error) {
+func queryHunterInternal(target, querySyntax string, cfg HunterConfig) ([]model.QueryResult, error) {
 	var allResults []model.QueryResult
-	client := &http.Client{Timeout: 30 * time.Second}
+	client, err := cfg.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("http client creation failed: %w", err)
+	}
 
 	page := 1
 	pageSize := 100 // Hunter默认每页100条
 
 	for {
-		params := buildHunterQuery(target, apiKey, page, pageSize)
+		trace := cfg.startPage("hunter", target, querySyntax, page)
+		params := buildHunterQuery(target, cfg.APIKey, page, pageSize)
 
 		// 构造请求URL
-		baseURL := "https://hunter.qianxin.com/openApi/search"
+		baseURL := cfg.endpoint(DefaultHunterBaseURL)
 		reqURL := baseURL + "?" + params.Encode()
 
 		req, err := http.NewRequest("GET", reqURL, nil)
 		if err != nil {
-			return nil, fmt.Errorf("request creation failed: %w", err)
+			return nil, trace.fail(ErrClassRequest, fmt.Errorf("request creation failed: %w", err))
 		}
+		cfg.applyHeaders(req)
 
 		resp, err := client.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("http request failed: %w", err)
+			return nil, trace.fail(networkErrorClass(err), fmt.Errorf("http request failed: %w", err))
 		}
+		trace.status(resp.StatusCode)
 
 		respBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
-			return nil, fmt.Errorf("read response failed: %w", err)
+			return nil, trace.fail(networkErrorClass(err), fmt.Errorf("read response failed: %w", err))
 		}
 
 		var hunterResp HunterAPIResponse
 		if err := json.Unmarshal(respBody, &hunterResp); err != nil {
-			return nil, fmt.Errorf("json unmarshal failed: %w", err)
+			return nil, trace.fail(ErrClassDecode, fmt.Errorf("json unmarshal failed: %w", err))
 		}
 
 		// 检查API错误
 		if hunterResp.Code != 200 {
-			return nil, fmt.Errorf("hunter API error: %s", hunterResp.Message)
+			return nil, trace.fail(ErrClassAPI, fmt.Errorf("hunter API error: %s", hunterResp.Message))
 		}
 
 		// 转换结果
@@ -130,6 +149,7 @@ func queryHunterInternal(target, apiKey string) ([]model.QueryResult, error) {
 		}
 
 		fmt.Printf("[Hunter] 第%d页扫描完成: %s -> 获得%d条结果\n", page, target, pageResults)
+		trace.done(pageResults, parseHunterQuota(hunterResp.Data.ConsumeQuota))
 
 		// 检查是否还有更多数据
 		if len(hunterResp.Data.Arr) < pageSize {
@@ -151,7 +171,7 @@ func queryHunterInternal(target, apiKey string) ([]model.QueryResult, error) {
 // convertHunterItemToResult 转换Hunter单条结果为模型结构
 func convertHunterItemToResult(unit string, item map[string]interface{}) model.QueryResult {
 	// 从map中提取字段
-	ip := stringFromAny(item["ip"])
+	ip := util.CanonicalIP(stringFromAny(item["ip"]))
 	port := intFromAny(item["port"])
 	protocol := stringFromAny(item["protocol"])
 	title := strings.TrimSpace(strings.Trim(stringFromAny(item["web_title"]), "\n"))
@@ -176,7 +196,11 @@ func convertHunterItemToResult(unit string, item map[string]interface{}) model.Q
 
 	// 构造URL：使用API返回的端口
 	finalPort := port
-	url := constructHunterURL(host, ip, finalPort, protocol)
+	// 非web服务不构造URL，作为服务单独入库
+	url := ""
+	if isWebProtocol(protocol) {
+		url = constructHunterURL(host, ip, finalPort, protocol)
+	}
 
 	return model.QueryResult{
 		Unit:        unit,
@@ -191,7 +215,43 @@ func convertHunterItemToResult(unit string, item map[string]interface{}) model.Q
 		Title:       title,
 		Source:      "hunter",
 		Reliability: 0,
+		Transport:   stringFromAny(item["base_protocol"]),
+		Server:      stringFromAny(item["header_server"]),
+		Product:     hunterComponents(item),
+		OS:          stringFromAny(item["os"]),
+		Banner:      stringFromAny(item["banner"]),
+		ICP:         stringFromAny(item["number"]),
+		ICPCompany:  stringFromAny(item["company"]),
+		Country:     stringFromAny(item["country"]),
+		Province:    stringFromAny(item["province"]),
+		City:        stringFromAny(item["city"]),
+		Org:         stringFromAny(item["as_org"]),
+		LastSeen:    normalizeTime(stringFromAny(item["updated_at"])),
+	}
+}
+
+// hunterComponents 汇总Hunter识别出的组件（如 致远OA、泛微），有版本号时以 名称/版本 表示
+func hunterComponents(item map[string]interface{}) string {
+	components, ok := item["component"].([]interface{})
+	if !ok {
+		return ""
+	}
+	var products []string
+	for _, c := range components {
+		cm, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name := strings.TrimSpace(stringFromAny(cm["name"]))
+		if name == "" {
+			continue
+		}
+		if version := strings.TrimSpace(stringFromAny(cm["version"])); version != "" {
+			name += "/" + version
+		}
+		products = append(products, name)
 	}
+	return joinList(products)
 }
 
 // constructHunterURL 根据Hunter数据构造完整URL
@@ -200,11 +260,12 @@ func constructHunterURL(host, ip string, port int, protocol string) string {
 		return ""
 	}
 
-	// 确定使用host还是ip
+	// 确定使用host还是ip，IPv6 字面量加方括号
 	targetHost := host
 	if targetHost == "" {
 		targetHost = ip
 	}
+	targetHost = util.URLHost(targetHost)
 
 	// 处理协议
 	if protocol == "" {
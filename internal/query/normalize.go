@@ -1,9 +1,11 @@
 package query
 
 import (
+	"cyberspace_mapping_summary/internal/util"
 	"net"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // stringFromAny 助手函数，interface{}转string
@@ -14,14 +16,132 @@ func stringFromAny(value interface{}) string {
 	return ""
 }
 
-// intFromAny 助手函数，接口转int
+// intFromAny 助手函数，接口转int（兼容以字符串返回的数字，如FOFA的port）
 func intFromAny(value interface{}) int {
-	if v, ok := value.(float64); ok {
+	switch v := value.(type) {
+	case float64:
 		return int(v)
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// textFromAny 助手函数，将字符串或数字统一转为字符串（如ASN可能以数字返回）
+func textFromAny(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// valueAt 按路径逐层读取嵌套map中的值，路径不存在时返回nil
+func valueAt(item map[string]interface{}, keys ...string) interface{} {
+	var current interface{} = item
+	for _, key := range keys {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+// stringsFromAny 将字符串数组（[]interface{}）转为[]string，忽略非字符串元素
+func stringsFromAny(value interface{}) []string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	var result []string
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// timeLayouts 各平台返回的时间格式
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000Z",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// normalizeTime 将平台返回的时间统一为 2006-01-02 15:04:05 格式，无法解析时原样返回
+func normalizeTime(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02 15:04:05")
+		}
+	}
+	return value
+}
+
+// joinList 去除空白项并去重后以分号连接，保持原有顺序
+func joinList(items []string) string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		result = append(result, item)
+	}
+	return strings.Join(result, ";")
+}
+
+// statusCodeFromHeader 从原始响应头的状态行（如 HTTP/1.1 200 OK）中解析状态码
+func statusCodeFromHeader(header string) int {
+	line := strings.TrimSpace(strings.SplitN(header, "\n", 2)[0])
+	if !strings.HasPrefix(strings.ToUpper(line), "HTTP/") {
+		return 0
+	}
+	parts := strings.Fields(line)
+	if len(parts) < 2 {
+		return 0
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
+// contentLengthFromHeader 从原始响应头中解析Content-Length
+func contentLengthFromHeader(header string) int {
+	for _, line := range strings.Split(header, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return n
+		}
 	}
 	return 0
 }
 
+// isWebProtocol 判断平台返回的协议是否为web协议（协议为空时按web处理，由端口推断http/https）
+func isWebProtocol(protocol string) bool {
+	return protocol == "" || protocol == "http" || protocol == "https"
+}
+
 // extractHostAndPort 从URL或host中提取域名和端口号
 func extractHostAndPort(urlOrHost string) (string, int) {
 	if urlOrHost == "" {
@@ -42,6 +162,20 @@ func extractHostAndPort(urlOrHost string) (string, int) {
 		withoutProtocol = withoutProtocol[:slashIndex]
 	}
 
+	// IPv6 字面量：带端口时写作 [2001:db8::1]:8443，不带端口时可能带方括号或直接给出地址
+	if strings.HasPrefix(withoutProtocol, "[") {
+		if host, portPart, err := net.SplitHostPort(withoutProtocol); err == nil {
+			if port, err := strconv.Atoi(portPart); err == nil && port > 0 && port <= 65535 {
+				return util.CanonicalIP(host), port
+			}
+			return util.CanonicalIP(host), 0
+		}
+		return util.CanonicalIP(withoutProtocol), 0
+	}
+	if strings.Count(withoutProtocol, ":") > 1 {
+		return util.CanonicalIP(withoutProtocol), 0
+	}
+
 	// 检查是否包含端口号
 	if colonIndex := strings.Index(withoutProtocol, ":"); colonIndex != -1 {
 		host := withoutProtocol[:colonIndex]
@@ -3,23 +3,26 @@ package query
 import (
 	"bytes"
 	"cyberspace_mapping_summary/internal/model"
+	"cyberspace_mapping_summary/internal/util"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 )
 
-// QuakeConfig 用于配置API Key
+// QuakeConfig 用于配置API Key及请求定制项
 type QuakeConfig struct {
 	APIKey string
+	ProviderOptions
 }
 
 // QuakeAPIResponse 定义API返回结构
 type QuakeAPIResponse struct {
-	Meta struct {
+	Code    interface{} `json:"code"` // 成功为0，业务错误为数字或字符串错误码（如 "u3005"）
+	Message string      `json:"message"`
+	Meta    struct {
 		PaginationID string `json:"pagination_id"`
 	} `json:"meta"`
 	Data []map[string]interface{} `json:"data"`
@@ -66,7 +69,7 @@ func buildPaginationPayload(target, paginationID string) map[string]interface{}
 }
 
 // QueryQuake 单域名或IP查询接口，返回结果列表或错误
-func QueryQuake(target, apiKey string) ([]model.QueryResult, error) {
+func QueryQuake(target string, cfg QuakeConfig) ([]model.QueryResult, error) {
 	// 构造查询语法用于日志显示
 	var querySyntax string
 	if isCIDR(target) || isIP(target) {
@@ -79,47 +82,58 @@ func QueryQuake(target, apiKey string) ([]model.QueryResult, error) {
 
 	// 使用重试机制执行查询
 	return retryWithBackoff("Quake", target, func() ([]model.QueryResult, error) {
-		return queryQuakeInternal(target, apiKey)
+		return queryQuakeInternal(target, querySyntax, cfg)
 	})
 }
 
 // queryQuakeInternal Quake查询的内部实现
-func queryQuakeInternal(target, apiKey string) ([]model.QueryResult, error) {
+func queryQuakeInternal(target, querySyntax string, cfg QuakeConfig) ([]model.QueryResult, error) {
 	var allResults []model.QueryResult
-	client := &http.Client{Timeout: 30 * time.Second}
+	client, err := cfg.newHTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("http client creation failed: %w", err)
+	}
 
 	payload := buildInitialPayload(target)
 	paginationID := ""
 	page := 0
 
 	for {
+		trace := cfg.startPage("quake", target, querySyntax, page+1)
 		body, err := json.Marshal(payload)
 		if err != nil {
-			return nil, fmt.Errorf("json marshal failed: %w", err)
+			return nil, trace.fail(ErrClassRequest, fmt.Errorf("json marshal failed: %w", err))
 		}
 
-		req, err := http.NewRequest("POST", "https://quake.360.net/api/v3/scroll/quake_service", bytes.NewBuffer(body))
+		req, err := http.NewRequest("POST", cfg.endpoint(DefaultQuakeBaseURL), bytes.NewBuffer(body))
 		if err != nil {
-			return nil, fmt.Errorf("request creation failed: %w", err)
+			return nil, trace.fail(ErrClassRequest, fmt.Errorf("request creation failed: %w", err))
 		}
 
-		req.Header.Set("X-QuakeToken", apiKey)
+		req.Header.Set("X-QuakeToken", cfg.APIKey)
 		req.Header.Set("Content-Type", "application/json")
+		cfg.applyHeaders(req)
 
 		resp, err := client.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("http request failed: %w", err)
+			return nil, trace.fail(networkErrorClass(err), fmt.Errorf("http request failed: %w", err))
 		}
+		trace.status(resp.StatusCode)
 
 		respBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
-			return nil, fmt.Errorf("read response failed: %w", err)
+			return nil, trace.fail(networkErrorClass(err), fmt.Errorf("read response failed: %w", err))
 		}
 
 		var quakeResp QuakeAPIResponse
 		if err := json.Unmarshal(respBody, &quakeResp); err != nil {
-			return nil, fmt.Errorf("json unmarshal failed: %w", err)
+			return nil, trace.fail(ErrClassDecode, fmt.Errorf("json unmarshal failed: %w", err))
+		}
+
+		// 检查API错误
+		if !quakeCodeOK(quakeResp.Code) {
+			return nil, trace.fail(ErrClassAPI, fmt.Errorf("quake API error: %v %s", quakeResp.Code, quakeResp.Message))
 		}
 
 		pageResults := 0
@@ -130,6 +144,8 @@ func queryQuakeInternal(target, apiKey string) ([]model.QueryResult, error) {
 		}
 
 		fmt.Printf("[Quake] 第%d页扫描完成: %s -> 获得%d条结果\n", page+1, target, pageResults)
+		// Quake 响应中不返回本次消耗，积分记为0（未知）
+		trace.done(pageResults, 0)
 
 		if len(quakeResp.Data) < 1000 {
 			break
@@ -144,6 +160,19 @@ func queryQuakeInternal(target, apiKey string) ([]model.QueryResult, error) {
 	return allResults, nil
 }
 
+// quakeCodeOK 判断Quake响应码是否表示成功（未返回响应码时视为成功）
+func quakeCodeOK(code interface{}) bool {
+	switch v := code.(type) {
+	case nil:
+		return true
+	case float64:
+		return v == 0
+	case string:
+		return v == "" || v == "0"
+	}
+	return false
+}
+
 // convertQuakeItemToResult 转换单条结果为模型结构
 func convertQuakeItemToResult(unit string, item map[string]interface{}) model.QueryResult {
 	// 1. Domain/Host 分离处理
@@ -163,7 +192,7 @@ func convertQuakeItemToResult(unit string, item map[string]interface{}) model.Qu
 	// 2. IP
 	ip := ""
 	if v, ok := item["ip"].(string); ok {
-		ip = v
+		ip = util.CanonicalIP(v)
 	}
 
 	// 3. Port
@@ -198,10 +227,8 @@ func convertQuakeItemToResult(unit string, item map[string]interface{}) model.Qu
 				}
 			}
 		}
-	} else {
-		// 非web，url为协议+host+端口，防止出现一堆空结果互相“去重”后抵消，导致结果不全
-		url = protocol + "://" + host + ":" + strconv.Itoa(port)
 	}
+	// 非web服务不构造URL（constructURLFromItem返回空），按ip:port作为服务单独入库
 
 	return model.QueryResult{
 		Unit:        unit,
@@ -216,7 +243,43 @@ func convertQuakeItemToResult(unit string, item map[string]interface{}) model.Qu
 		Title:       title,
 		Source:      "quake",
 		Reliability: 0,
+		Transport:   stringFromAny(item["transport"]),
+		Server:      stringFromAny(valueAt(item, "service", "http", "server")),
+		Product:     quakeProducts(item),
+		Banner:      stringFromAny(valueAt(item, "service", "response")),
+		Header:      stringFromAny(valueAt(item, "service", "http", "response_headers")),
+		CertSubject: stringFromAny(valueAt(item, "service", "tls", "handshake_log", "server_certificates", "certificate", "parsed", "subject_dn")),
+		CertSAN:     joinList(stringsFromAny(valueAt(item, "service", "tls", "handshake_log", "server_certificates", "certificate", "parsed", "extensions", "subject_alt_name", "dns_names"))),
+		ICP:         stringFromAny(valueAt(item, "service", "http", "icp", "licence")),
+		ICPCompany:  stringFromAny(valueAt(item, "service", "http", "icp", "main_licence", "unit")),
+		Country:     stringFromAny(valueAt(item, "location", "country_cn")),
+		Province:    stringFromAny(valueAt(item, "location", "province_cn")),
+		City:        stringFromAny(valueAt(item, "location", "city_cn")),
+		ASN:         textFromAny(item["asn"]),
+		Org:         stringFromAny(item["org"]),
+		LastSeen:    normalizeTime(stringFromAny(item["time"])),
+		IconHash:    textFromAny(valueAt(item, "service", "http", "favicon", "hash")),
+	}
+}
+
+// quakeProducts 汇总Quake识别出的组件名称（components优先，其次service.product）
+func quakeProducts(item map[string]interface{}) string {
+	var products []string
+	if components, ok := item["components"].([]interface{}); ok {
+		for _, c := range components {
+			cm, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := stringFromAny(cm["product_name_cn"])
+			if name == "" {
+				name = stringFromAny(cm["product_name_en"])
+			}
+			products = append(products, name)
+		}
 	}
+	products = append(products, stringFromAny(valueAt(item, "service", "product")))
+	return joinList(products)
 }
 
 // constructURLFromItem 根据item信息构造完整URL
@@ -261,17 +324,18 @@ func constructURLFromItem(item map[string]interface{}) (string, string) {
 				host = ip
 			}
 		}
-		// 4. 构造基础URL-web
+		// 4. 构造基础URL-web（IPv6 字面量加方括号）
+		urlHost := util.URLHost(host)
 		if port > 0 && (protocol == "http" || protocol == "https") {
 			// http 80 和 https 443 不添加端口
 			if (protocol == "http" && port == 80) || (protocol == "https" && port == 443) {
-				baseURL = protocol + "://" + host
+				baseURL = protocol + "://" + urlHost
 			} else if protocol == "http" && port == 443 { //http 443 自动转为https，不加端口
-				baseURL = "https://" + host
+				baseURL = "https://" + urlHost
 			} else if protocol == "https" && port == 80 { //https 80 自动转为http，不加端口
-				baseURL = "http://" + host
+				baseURL = "http://" + urlHost
 			} else {
-				baseURL = protocol + "://" + host + ":" + strconv.Itoa(port) //其他情况 protocol+host+port
+				baseURL = protocol + "://" + urlHost + ":" + strconv.Itoa(port) //其他情况 protocol+host+port
 			}
 		}
 		// 5. 获取并添加路径
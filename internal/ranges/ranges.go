@@ -0,0 +1,190 @@
+package ranges
+
+import (
+	"bufio"
+	"bytes"
+	"cyberspace_mapping_summary/internal/model"
+	_ "embed"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultFile 默认的CDN与云厂商网段库文件
+const DefaultFile = "ip_ranges.csv"
+
+// 网段库中的类别
+const (
+	CategoryCDN     = "cdn"     // CDN边缘节点
+	CategoryCloud   = "cloud"   // 公有云
+	CategoryHosting = "hosting" // 主机托管/VPS
+)
+
+//go:embed ip_ranges.csv
+var defaultRanges []byte
+
+// entry 网段库中的一条记录
+type entry struct {
+	category string
+	provider string
+}
+
+// tag 结果中记录的厂商标记，如 cdn:cloudflare
+func (e entry) tag() string {
+	return e.category + ":" + e.provider
+}
+
+// prefixEntry 按网段匹配的记录
+type prefixEntry struct {
+	prefix netip.Prefix
+	entry
+}
+
+// Set CDN与云厂商网段库，零值（nil）不匹配任何IP
+type Set struct {
+	prefixes []prefixEntry    // 按掩码由长到短排序，先命中的最具体
+	asns     map[string]entry // AS号（不含AS前缀） -> 记录
+}
+
+// Load 读取网段库文件，文件不存在时写出内置的默认网段库后再读取
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if err := os.WriteFile(path, defaultRanges, 0644); err != nil {
+			return nil, fmt.Errorf("生成默认网段库失败: %w", err)
+		}
+		fmt.Printf("[*] 已生成默认CDN与云厂商网段库: %s（可按文件中列出的来源更新）\n", path)
+		data = defaultRanges
+	} else if err != nil {
+		return nil, fmt.Errorf("读取网段库失败: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse 解析网段库内容：每行 类别,厂商,网段或ASN，# 开头为注释
+func Parse(data []byte) (*Set, error) {
+	s := &Set{asns: make(map[string]entry)}
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("网段库第 %d 行格式错误，应为 类别,厂商,网段或ASN: %s", line, text)
+		}
+		e := entry{
+			category: strings.ToLower(strings.TrimSpace(fields[0])),
+			provider: strings.ToLower(strings.TrimSpace(fields[1])),
+		}
+		switch e.category {
+		case CategoryCDN, CategoryCloud, CategoryHosting:
+		default:
+			return nil, fmt.Errorf("网段库第 %d 行类别 %q 不受支持，应为 cdn / cloud / hosting", line, e.category)
+		}
+		if e.provider == "" {
+			return nil, fmt.Errorf("网段库第 %d 行缺少厂商名称", line)
+		}
+
+		value := strings.TrimSpace(fields[2])
+		if strings.HasPrefix(strings.ToUpper(value), "AS") {
+			asn := normalizeASN(value)
+			if asn == "" {
+				return nil, fmt.Errorf("网段库第 %d 行AS号 %q 无效", line, value)
+			}
+			s.asns[asn] = e
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("网段库第 %d 行网段 %q 无效: %v", line, value, err)
+		}
+		s.prefixes = append(s.prefixes, prefixEntry{prefix: prefix.Masked(), entry: e})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(s.prefixes, func(i, j int) bool { return s.prefixes[i].prefix.Bits() > s.prefixes[j].prefix.Bits() })
+	return s, nil
+}
+
+// Len 返回网段与ASN记录数
+func (s *Set) Len() (int, int) {
+	if s == nil {
+		return 0, 0
+	}
+	return len(s.prefixes), len(s.asns)
+}
+
+// Match 返回IP所属厂商的标记（如 cdn:cloudflare），网段优先于ASN，均未命中时为空
+func (s *Set) Match(ip, asn string) string {
+	if s == nil {
+		return ""
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(strings.TrimSpace(ip), "[]")); err == nil {
+		addr = addr.Unmap()
+		for _, p := range s.prefixes {
+			if p.prefix.Contains(addr) {
+				return p.tag()
+			}
+		}
+	}
+	if e, ok := s.asns[normalizeASN(asn)]; ok {
+		return e.tag()
+	}
+	return ""
+}
+
+// MatchCIDR 返回整段包含该网段的网段库记录的标记（多条时取掩码最长者），未命中时为空
+// 只与网段部分重叠的记录（如单位 /24 中的一个 /29 云主机段）不算命中，由调用方按段内IP另行判断
+func (s *Set) MatchCIDR(cidr string) string {
+	if s == nil {
+		return ""
+	}
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return ""
+	}
+	prefix = prefix.Masked()
+	for _, p := range s.prefixes {
+		if p.prefix.Bits() <= prefix.Bits() && p.prefix.Contains(prefix.Addr()) {
+			return p.tag()
+		}
+	}
+	return ""
+}
+
+// Tag 为结果标记IP所属的CDN或云厂商
+func (s *Set) Tag(results []model.QueryResult) {
+	if s == nil {
+		return
+	}
+	for i := range results {
+		if tag := s.Match(results[i].IP, results[i].ASN); tag != "" {
+			results[i].IPProvider = tag
+		}
+	}
+}
+
+// normalizeASN 去除AS前缀与空白，如 "AS37963" -> "37963"，不是AS号时为空
+func normalizeASN(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[:2], "AS") {
+		value = strings.TrimSpace(value[2:])
+	}
+	if value == "" {
+		return ""
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return ""
+		}
+	}
+	return value
+}
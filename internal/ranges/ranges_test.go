@@ -0,0 +1,95 @@
+package ranges
+
+import "testing"
+
+const testRanges = "\xef\xbb\xbf# 测试网段库\n" + `
+cdn,cloudflare,104.16.0.0/13
+cloud,aliyun,47.96.0.0/11
+cloud,AliYun,47.98.1.0/24
+cloud,tencentcloud,2402:4e00::/32
+cloud,aliyun,AS37963
+hosting,vultr,as20473
+`
+
+func TestParseDefaultRanges(t *testing.T) {
+	s, err := Parse(defaultRanges)
+	if err != nil {
+		t.Fatalf("解析内置网段库失败: %v", err)
+	}
+	if prefixes, asns := s.Len(); prefixes == 0 || asns == 0 {
+		t.Errorf("内置网段库: %d 个网段, %d 个ASN", prefixes, asns)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"cdn,cloudflare",
+		"cdn,,104.16.0.0/13",
+		"isp,chinanet,1.0.0.0/8",
+		"cloud,aliyun,ASxyz",
+		"cloud,aliyun,47.96.0.0/33",
+	}
+	for _, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%q) 未返回错误", data)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	s, err := Parse([]byte(testRanges))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip, asn string
+		want    string
+	}{
+		{"104.16.1.1", "", "cdn:cloudflare"},
+		{"47.98.1.10", "", "cloud:aliyun"},
+		{"::ffff:47.100.0.1", "", "cloud:aliyun"},
+		{"2402:4e00:1::1", "", "cloud:tencentcloud"},
+		{"[2402:4e00:1::1]", "", "cloud:tencentcloud"},
+		{"8.8.8.8", "AS37963", "cloud:aliyun"},
+		{"8.8.8.8", "20473", "hosting:vultr"},
+		{"104.16.1.1", "20473", "cdn:cloudflare"},
+		{"8.8.8.8", "15169", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := s.Match(tt.ip, tt.asn); got != tt.want {
+			t.Errorf("Match(%q, %q) = %q, want %q", tt.ip, tt.asn, got, tt.want)
+		}
+	}
+}
+
+func TestMatchCIDR(t *testing.T) {
+	s, err := Parse([]byte(testRanges))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"104.16.5.0/24", "cdn:cloudflare"},
+		{"47.98.1.0/24", "cloud:aliyun"},
+		{"47.98.1.128/25", "cloud:aliyun"},
+		{"10.0.0.0/24", ""},
+		// 网段库中的网段只覆盖一部分时不算命中
+		{"104.0.0.0/8", ""},
+		{"47.96.0.0/10", ""},
+		{"2402:4e00:10::/64", "cloud:tencentcloud"},
+		{"invalid", ""},
+	}
+	for _, tt := range tests {
+		if got := s.MatchCIDR(tt.cidr); got != tt.want {
+			t.Errorf("MatchCIDR(%q) = %q, want %q", tt.cidr, got, tt.want)
+		}
+	}
+
+	var empty *Set
+	if got := empty.MatchCIDR("104.16.5.0/24"); got != "" {
+		t.Errorf("nil Set MatchCIDR = %q", got)
+	}
+}
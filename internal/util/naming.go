@@ -1,17 +1,27 @@
 package util
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 )
 
-// GenerateTaskID 生成统一的任务ID
+// GenerateTaskID 生成统一的任务ID：年月日_时间戳后8位_6位随机十六进制
+// 随机后缀保证同一秒内启动的多个任务（多人共用一台机器或脚本批量启动）不会得到相同的任务ID
 func GenerateTaskID() string {
 	now := time.Now()
 	dateStr := now.Format("20060102")
 	tsStr := fmt.Sprintf("%d", now.Unix())
 	shortTS := tsStr[len(tsStr)-8:]
-	return fmt.Sprintf("%s_%s", dateStr, shortTS)
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		binary.BigEndian.PutUint16(suffix[1:], uint16(now.Nanosecond()))
+	}
+	return fmt.Sprintf("%s_%s_%s", dateStr, shortTS, hex.EncodeToString(suffix))
 }
 
 // GenerateTableName 生成数据库表名
@@ -19,6 +29,14 @@ func GenerateTableName(taskID string) string {
 	return fmt.Sprintf("task_%s", taskID)
 }
 
+// TableNameFromArg 将命令行传入的任务ID（20250726_12345678）或任务表名统一为表名
+func TableNameFromArg(arg string) string {
+	if strings.HasPrefix(arg, "task_") {
+		return arg
+	}
+	return GenerateTableName(arg)
+}
+
 // GenerateCSVFileName 生成CSV文件名
 func GenerateCSVFileName(taskID, suffix string) string {
 	return fmt.Sprintf("%s_%s.csv", taskID, suffix)
@@ -29,8 +47,7 @@ func GenerateTXTFileName(taskID, suffix string) string {
 	return fmt.Sprintf("%s_%s.txt", taskID, suffix)
 }
 
-// GenerateProjectDir 生成项目目录名
-func GenerateProjectDir(baseDir string) string {
-	taskID := GenerateTaskID()
-	return fmt.Sprintf("%s_%s", taskID[:8], taskID[9:]) // 格式：20250726_155103
+// GenerateProjectDir 生成项目目录名，与任务ID一致，并发运行的任务输出互不覆盖
+func GenerateProjectDir(taskID string) string {
+	return taskID // 格式：20250726_12345678_a1b2c3
 }
@@ -17,6 +17,10 @@ var (
 		mustCIDR("192.168.0.0/16"),
 		mustCIDR("127.0.0.0/8"),    // Loopback
 		mustCIDR("169.254.0.0/16"), // Link-local
+		mustCIDR("::1/128"),        // IPv6 Loopback
+		mustCIDR("fc00::/7"),       // IPv6 唯一本地地址
+		mustCIDR("fe80::/10"),      // IPv6 Link-local
+		mustCIDR("ff00::/8"),       // IPv6 组播
 	}
 )
 
@@ -29,8 +33,11 @@ func mustCIDR(cidr string) *net.IPNet {
 	return ipnet
 }
 
-// isPrivateIP 判断是否为内网 IP
+// isPrivateIP 判断是否为内网 IP（含未指定地址 0.0.0.0 与 ::）
 func isPrivateIP(ip net.IP) bool {
+	if ip.IsUnspecified() {
+		return true
+	}
 	for _, cidr := range privateCIDRs {
 		if cidr.Contains(ip) {
 			return true
@@ -39,9 +46,9 @@ func isPrivateIP(ip net.IP) bool {
 	return false
 }
 
-// IsValidHost 验证是否为合法公网 IP 或合法域名
+// IsValidHost 验证是否为合法公网 IP（IPv4 / IPv6，可带方括号）、公网网段或合法域名
 func IsValidHost(host string) bool {
-	host = strings.TrimSpace(host)
+	host = NormalizeHost(host)
 	if host == "" {
 		return false
 	}
@@ -58,21 +65,14 @@ func IsValidHost(host string) bool {
 			return false // 无效的CIDR格式
 		}
 		// 检查CIDR的IP是否为公网IP
-		ip := ipnet.IP
-		if ip.To4() == nil {
-			return false // 排除 IPv6
-		}
-		if isPrivateIP(ip) {
-			return false // 排除内网 IP
+		if isPrivateIP(ipnet.IP) {
+			return false // 排除内网网段
 		}
 		return true // 合法公网 CIDR
 	}
 
-	// 检查 IP（仅允许公网 IPv4）
+	// 检查 IP
 	if ip := net.ParseIP(host); ip != nil {
-		if ip.To4() == nil {
-			return false // 排除 IPv6
-		}
 		if isPrivateIP(ip) {
 			return false // 排除内网 IP
 		}
@@ -82,3 +82,41 @@ func IsValidHost(host string) bool {
 	// 检查域名
 	return domainRegexp.MatchString(host)
 }
+
+// NormalizeHost 规范化目标：去除空白与 IPv6 字面量的方括号，IPv6 地址与网段统一为小写压缩形式
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if strings.Contains(host, "/") {
+		if ip, ipnet, err := net.ParseCIDR(host); err == nil && ip.To4() == nil {
+			return ipnet.String()
+		}
+		return host
+	}
+	return CanonicalIP(host)
+}
+
+// CanonicalIP 将 IP 统一为标准写法（IPv6 小写压缩形式，IPv4 映射地址转为 IPv4），不是 IP 时原样返回
+func CanonicalIP(s string) string {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(strings.Trim(s, "[]")); ip != nil {
+		return ip.String()
+	}
+	return s
+}
+
+// IsIPv6 判断是否为 IPv6 地址
+func IsIPv6(s string) bool {
+	ip := net.ParseIP(strings.Trim(strings.TrimSpace(s), "[]"))
+	return ip != nil && ip.To4() == nil
+}
+
+// URLHost 返回可直接拼入 URL 的主机名：IPv6 字面量加方括号，如 [2001:db8::1]
+func URLHost(host string) string {
+	if IsIPv6(host) && !strings.HasPrefix(host, "[") {
+		return "[" + host + "]"
+	}
+	return host
+}